@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"simpleAuth/config"
+	"time"
+)
+
+// Generates a key pair and writes it to the keys directory as PKCS#8 and PKIX PEM files.
+// The private key is readable by the owner only, existing files are never overwritten.
+func keygenCommand(opts *options, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	keyType := flags.String("type", "rsa", "key type: rsa, ec (P-256) or ed25519")
+	bits := flags.Int("bits", 2048, "RSA key size")
+	name := flags.String("name", "", "file name prefix, jwt-<type>-<timestamp> if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = fmt.Sprintf("jwt-%s-%s", *keyType, time.Now().Format("20060102-150405"))
+	}
+
+	privateKey, err := generateKey(*keyType, *bits)
+	if err != nil {
+		return err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.keysDir, 0700); err != nil {
+		return err
+	}
+	privatePath := filepath.Join(opts.keysDir, *name+"-private.pem")
+	publicPath := filepath.Join(opts.keysDir, *name+"-public.pem")
+
+	if err := writePEM(privatePath, &pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}, 0600); err != nil {
+		return err
+	}
+	if err := writePEM(publicPath, &pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}, 0644); err != nil {
+		return err
+	}
+
+	keyID, err := config.KeyThumbprint(privateKey.Public())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "kid:         %s\n", keyID)
+	fmt.Fprintf(stdout, "private key: %s\n", privatePath)
+	fmt.Fprintf(stdout, "public key:  %s\n", publicPath)
+	return nil
+}
+
+// Generates a private key usable with the supported signing algorithms.
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa":
+		if bits < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ec":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+	return nil, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+// Writes the PEM block to a new file with the given permissions.
+func writePEM(path string, block *pem.Block, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if err := pem.Encode(file, block); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
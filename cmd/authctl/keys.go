@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"simpleAuth/config"
+	"time"
+)
+
+// Lists the keys accepted for verification, the signing key first.
+func keysCommand(opts *options, args []string, stdout io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: authctl keys")
+	}
+	cfg := opts.loadConfig()
+
+	signingKey := cfg.Keys.SigningKey()
+	for _, key := range cfg.Keys.VerificationKeys() {
+		fingerprint, err := keyFingerprint(key)
+		if err != nil {
+			return err
+		}
+
+		role := "verify"
+		if key == signingKey {
+			role = "signing"
+		}
+		keyType := "public"
+		if key.PrivateKey != nil {
+			keyType = "private"
+		}
+
+		fmt.Fprintf(stdout, "%s\n", key.ID)
+		fmt.Fprintf(stdout, "  role:        %s (%s key)\n", role, keyType)
+		fmt.Fprintf(stdout, "  algorithm:   %s\n", key.Algorithm)
+		fmt.Fprintf(stdout, "  activated:   %s\n", key.ActivatedAt.Format(time.RFC3339))
+		fmt.Fprintf(stdout, "  fingerprint: SHA256:%s\n", fingerprint)
+	}
+	return nil
+}
+
+// Computes the SHA-256 fingerprint of the DER encoded public key, as printed by
+// "openssl pkey -pubin -outform DER | sha256sum".
+func keyFingerprint(key *config.Key) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,69 @@
+// Command authctl administers access tokens and signing keys offline,
+// using the service configuration without the HTTP server or the database.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"simpleAuth/config"
+)
+
+// Subcommand of authctl
+type command struct {
+	syntax      string
+	description string
+	run         func(opts *options, args []string, stdout io.Writer) error
+}
+
+// Global options of authctl
+type options struct {
+	envFile string
+	keysDir string
+}
+
+// Loads the service configuration, commands load it on demand so they can fail on bad arguments first.
+func (o *options) loadConfig() *config.Config {
+	return config.LoadConfig(context.Background(), o.envFile, o.keysDir)
+}
+
+var commands = map[string]command{
+	"mint":   {"mint -user ID [-session ID] [-scope SCOPES] [-ttl MINUTES]", "mint an access token", mintCommand},
+	"verify": {"verify TOKEN", "verify a token and print the verdict", verifyCommand},
+	"decode": {"decode TOKEN", "print the header and claims without verification", decodeCommand},
+	"keys":   {"keys", "list the keys with their kid and fingerprint", keysCommand},
+	"keygen": {"keygen [-type rsa|ec|ed25519] [-bits BITS] [-name NAME]", "generate a key pair in the keys directory", keygenCommand},
+}
+
+// Order of the commands in the usage message
+var commandNames = []string{"mint", "verify", "decode", "keys", "keygen"}
+
+func main() {
+	flags := flag.NewFlagSet("authctl", flag.ExitOnError)
+	opts := &options{}
+	flags.StringVar(&opts.envFile, "env", ".env", "environment file of the service")
+	flags.StringVar(&opts.keysDir, "keys", "certs", "directory with the signing keys")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: authctl [-env FILE] [-keys DIR] COMMAND [ARGS]")
+		fmt.Fprintln(os.Stderr, "\nCommands:")
+		for _, name := range commandNames {
+			fmt.Fprintf(os.Stderr, "  %-60s %s\n", commands[name].syntax, commands[name].description)
+		}
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(opts, flags.Args()[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "authctl:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"simpleAuth/services"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mints an access token with the scopes granted to the user at sign-in.
+func mintCommand(opts *options, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("mint", flag.ContinueOnError)
+	userID := flags.String("user", "", "user ID (sub)")
+	sessionID := flags.String("session", "", "session ID (sid), random if empty")
+	scope := flags.String("scope", "", "space-delimited scopes, all scopes allowed for the user if empty")
+	ttl := flags.Int("ttl", 0, "lifetime in minutes, ACCESS_TOKEN_EXPIRE_MINUTES if zero")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return fmt.Errorf("-user is required")
+	}
+	if *ttl < 0 || *ttl > math.MaxInt16 {
+		return fmt.Errorf("-ttl must be 0 (default) or between 1 and %d minutes", math.MaxInt16)
+	}
+	if *sessionID == "" {
+		*sessionID = uuid.New().String()
+	}
+
+	cfg := opts.loadConfig()
+	if *ttl > 0 {
+		cfg.AccessTokenExpireMinutes = int16(*ttl)
+	}
+
+	roles, scopes := services.GrantScopes(cfg, *userID, services.ParseScope(*scope))
+	token, err := services.GenerateAccessToken(cfg, &services.CustomClaims{
+		Subject: *userID,
+		SID:     *sessionID,
+		Scope:   services.FormatScope(scopes),
+		Roles:   roles,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, token)
+	return nil
+}
+
+// Verifies the signature, issuer, audience and lifetime of a token.
+// Revocation and the session state are kept in the database and not checked.
+func verifyCommand(opts *options, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: authctl verify TOKEN")
+	}
+	cfg := opts.loadConfig()
+
+	claims, err := services.GetTokenPayload(cfg, args[0], false)
+	if err != nil {
+		fmt.Fprintf(stdout, "INVALID: %v\n", err)
+		return fmt.Errorf("token is not valid")
+	}
+
+	fmt.Fprintln(stdout, "VALID")
+	if header, _, err := services.DecodeTokenUnverified(cfg, args[0]); err == nil {
+		if keyID, ok := header["kid"]; ok {
+			fmt.Fprintf(stdout, "  key:      %v (%v)\n", keyID, header["alg"])
+		}
+	}
+	fmt.Fprintf(stdout, "  subject:  %s\n", claims.Subject)
+	fmt.Fprintf(stdout, "  session:  %s\n", claims.SID)
+	fmt.Fprintf(stdout, "  scope:    %s\n", claims.Scope)
+	fmt.Fprintf(stdout, "  issuer:   %s\n", claims.Issuer)
+	fmt.Fprintf(stdout, "  audience: %s\n", strings.Join(claims.Audience, ", "))
+	if claims.Act != nil {
+		fmt.Fprintf(stdout, "  actors:   %s\n", strings.Join(claims.Act.Chain(), " <- "))
+	}
+	if claims.ExpiresAt != nil {
+		fmt.Fprintf(stdout, "  expires:  %s (in %s)\n", claims.ExpiresAt.Format(time.RFC3339), time.Until(claims.ExpiresAt.Time).Round(time.Second))
+	}
+	fmt.Fprintln(stdout, "Revocation and the session state are not checked offline.")
+	return nil
+}
+
+// Prints the header and claims of a token without verifying it.
+func decodeCommand(opts *options, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: authctl decode TOKEN")
+	}
+
+	header, claims, err := services.DecodeTokenUnverified(opts.loadConfig(), args[0])
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]any{"header": header, "claims": claims})
+}
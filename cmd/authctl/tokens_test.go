@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"simpleAuth/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a service configuration and an Ed25519 signing key to a temporary directory.
+func setupTestOptions(t *testing.T) *options {
+	dir := t.TempDir()
+	opts := &options{envFile: filepath.Join(dir, ".env"), keysDir: filepath.Join(dir, "certs")}
+
+	env := strings.Join([]string{
+		"DB_HOST=db",
+		"DB_PORT=5432",
+		"DB_USER=postgres",
+		"DB_NAME=postgres",
+		"DB_PASSWORD=postgres",
+		"WEBHOOK_URL=http://localhost:9000/notify",
+		"ACCESS_TOKEN_EXPIRE_MINUTES=10",
+		"REFRESH_TOKEN_EXPIRE_MINUTES=60",
+		"JWT_ISSUER=https://auth.test",
+		"JWT_AUDIENCE=api",
+		"JWT_SIGNING_ALGORITHM=EdDSA",
+	}, "\n")
+	assert.NoError(t, os.WriteFile(opts.envFile, []byte(env), 0600))
+	assert.NoError(t, keygenCommand(opts, []string{"-type", "ed25519", "-name", "test"}, io.Discard))
+
+	return opts
+}
+
+func TestMintCommandArguments(t *testing.T) {
+	opts := setupTestOptions(t)
+
+	for _, test := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"missing user", []string{}, "-user is required"},
+		{"negative ttl", []string{"-user", "user", "-ttl", "-1"}, "-ttl must be 0 (default) or between 1 and 32767 minutes"},
+		{"ttl out of range", []string{"-user", "user", "-ttl", "32768"}, "-ttl must be 0 (default) or between 1 and 32767 minutes"},
+		{"unknown flag", []string{"-user", "user", "-lifetime", "5"}, "flag provided but not defined: -lifetime"},
+		{"default ttl", []string{"-user", "user"}, ""},
+		{"ttl", []string{"-user", "user", "-ttl", "5", "-scope", "profile"}, ""},
+		{"maximum ttl", []string{"-user", "user", "-ttl", "32767"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := mintCommand(opts, test.args, &stdout)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				assert.Empty(t, stdout.String())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, strings.TrimSpace(stdout.String()))
+		})
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	opts := setupTestOptions(t)
+
+	var minted bytes.Buffer
+	assert.NoError(t, mintCommand(opts, []string{"-user", "user", "-session", "session", "-scope", "profile"}, &minted))
+	token := strings.TrimSpace(minted.String())
+
+	cfg := opts.loadConfig()
+	cfg.AccessTokenExpireMinutes = -10
+	expiredToken, err := services.GenerateAccessToken(cfg, &services.CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+
+	cfg = opts.loadConfig()
+	cfg.TokenIssuer = "https://other.test"
+	foreignToken, err := services.GenerateAccessToken(cfg, &services.CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		verdict string
+		err     string
+	}{
+		{"valid", []string{token}, "VALID", ""},
+		{"tampered", []string{token[:len(token)-4] + "AAAA"}, "INVALID", "token is not valid"},
+		{"expired", []string{expiredToken}, "INVALID", "token is not valid"},
+		{"other issuer", []string{foreignToken}, "INVALID", "token is not valid"},
+		{"not a token", []string{"not-a-token"}, "INVALID", "token is not valid"},
+		{"missing token", []string{}, "", "usage: authctl verify TOKEN"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := verifyCommand(opts, test.args, &stdout)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			verdict, _, _ := strings.Cut(stdout.String(), "\n")
+			verdict, _, _ = strings.Cut(verdict, ":")
+			assert.Equal(t, test.verdict, verdict)
+		})
+	}
+
+	var stdout bytes.Buffer
+	assert.NoError(t, verifyCommand(opts, []string{token}, &stdout))
+	assert.Contains(t, stdout.String(), "  subject:  user\n")
+	assert.Contains(t, stdout.String(), "  session:  session\n")
+	assert.Contains(t, stdout.String(), "  scope:    profile\n")
+	assert.Contains(t, stdout.String(), "  issuer:   https://auth.test\n")
+}
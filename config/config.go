@@ -2,34 +2,92 @@ package config
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"os"
+	"math/big"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sethvargo/go-envconfig"
 	"github.com/sirupsen/logrus"
 )
 
+// Access token formats
+const (
+	AccessTokenFormatJWT    = "jwt"    // Signed self-contained tokens, verifiable with the published keys
+	AccessTokenFormatOpaque = "opaque" // Random reference tokens, resolved by lookup or introspection
+	AccessTokenFormatPASETO = "paseto" // PASETO v4.public tokens, signed with an Ed25519 key
+)
+
+// Policies applied when a user signing in has the maximum number of active sessions
+const (
+	SessionLimitPolicyReject = "reject" // Reject the sign-in
+	SessionLimitPolicyEvict  = "evict"  // Revoke the least recently used session
+)
+
 // Holds the configuration settings for the application.
 type Config struct {
-	DBHost                    string          `env:"DB_HOST"`                      // Database host
-	DBPort                    string          `env:"DB_PORT"`                      // Database port
-	DBUser                    string          `env:"DB_USER"`                      // Database user
-	DBName                    string          `env:"DB_NAME"`                      // Database name
-	DBPassword                string          `env:"DB_PASSWORD"`                  // Database password
-	WebhookURL                string          `env:"WEBHOOK_URL"`                  // Webhook URL for notifications
-	AccessTokenExpireMinutes  int16           `env:"ACCESS_TOKEN_EXPIRE_MINUTES"`  // Access token expiration time in minutes
-	RefreshTokenExpireMinutes int16           `env:"REFRESH_TOKEN_EXPIRE_MINUTES"` // Refresh token expiration time in minutes
-	RSAPrivateKey             *rsa.PrivateKey // RSA private key for signing tokens
-	RSAPublicKey              *rsa.PublicKey  // RSA public key for verifying tokens
+	DBHost                    string            `env:"DB_HOST"`                                      // Database host
+	DBPort                    string            `env:"DB_PORT"`                                      // Database port
+	DBUser                    string            `env:"DB_USER"`                                      // Database user
+	DBName                    string            `env:"DB_NAME"`                                      // Database name
+	DBPassword                string            `env:"DB_PASSWORD"`                                  // Database password
+	WebhookURL                string            `env:"WEBHOOK_URL"`                                  // Webhook URL for notifications
+	AccessTokenExpireMinutes  int16             `env:"ACCESS_TOKEN_EXPIRE_MINUTES"`                  // Access token expiration time in minutes
+	RefreshTokenExpireMinutes int16             `env:"REFRESH_TOKEN_EXPIRE_MINUTES"`                 // Refresh token expiration time in minutes
+	TokenIssuer               string            `env:"JWT_ISSUER"`                                   // Issuer ("iss") of access tokens, unique per environment
+	TokenAudience             []string          `env:"JWT_AUDIENCE"`                                 // Comma separated audiences ("aud") of access tokens
+	SessionMaxAgeMinutes      int32             `env:"SESSION_MAX_AGE_MINUTES, default=43200"`       // Absolute session lifetime from sign-in, the user has to sign in again afterwards; 0 disables
+	SessionIdleTimeoutMinutes int32             `env:"SESSION_IDLE_TIMEOUT_MINUTES, default=0"`      // Session is ended when not refreshed for this time; 0 disables
+	MaxSessionsPerUser        int16             `env:"MAX_SESSIONS_PER_USER, default=0"`             // Maximum number of active sessions per user; 0 disables the limit
+	SessionLimitPolicy        string            `env:"SESSION_LIMIT_POLICY, default=evict"`          // Sign-in at the session limit: reject or evict the least recently used session
+	AcceptLegacyRefreshTokens bool              `env:"ACCEPT_LEGACY_REFRESH_TOKENS, default=true"`   // Accept refresh tokens without the session ID together with the access token
+	RefreshTokenHashAlgorithm string            `env:"REFRESH_TOKEN_HASH_ALGORITHM, default=bcrypt"` // Refresh token hash algorithm: bcrypt, argon2id or hmac-sha256
+	RefreshTokenHashKey       string            `env:"REFRESH_TOKEN_HASH_KEY, default="`             // Secret key of the hmac-sha256 refresh token hash
+	TokenLeewaySeconds        int16             `env:"JWT_LEEWAY_SECONDS, default=30"`               // Allowed clock skew when validating time based claims
+	AdminUserIDs              []string          `env:"ADMIN_USER_IDS, default="`                     // Comma separated IDs of users granted the admin role
+	ActorUserIDs              []string          `env:"ACTOR_USER_IDS, default="`                     // Comma separated IDs of services granted the actor role, allowed to act on behalf of users in token exchange
+	OAuthClients              map[string]string `env:"OAUTH_CLIENTS, default="`                      // Comma separated client_id:secret pairs allowed to introspect tokens
+	CheckSessionOnRequest     bool              `env:"AUTH_CHECK_SESSION, default=true"`             // Look up the session on every authenticated request, revoked tokens are denied by the denylist either way
+	DenylistSyncSeconds       int16             `env:"DENYLIST_SYNC_SECONDS, default=5"`             // Interval of loading tokens revoked by other replicas, must be positive
+	PublicURL                 string            `env:"PUBLIC_URL, default="`                         // External base URL of the service behind a proxy, e.g. https://auth.example.com, matched against the DPoP "htu" claim
+	TLSCertFile               string            `env:"TLS_CERT_FILE, default="`                      // Server certificate, the server listens with TLS when set
+	TLSKeyFile                string            `env:"TLS_KEY_FILE, default="`                       // Server certificate private key
+	TLSClientCAFile           string            `env:"TLS_CLIENT_CA_FILE, default="`                 // CA bundle verifying client certificates for certificate-bound tokens
+	AccessTokenFormat         string            `env:"ACCESS_TOKEN_FORMAT, default=jwt"`             // Format of issued access tokens: jwt, paseto or opaque
+	EncryptionAlgorithm       string            `env:"JWE_ALGORITHM, default="`                      // Encrypt access tokens with RSA-OAEP-256 or dir and A256GCM, disabled if empty
+	EncryptionKeyFile         string            `env:"JWE_KEY_FILE, default="`                       // RSA private key shared with the resource servers for RSA-OAEP-256
+	EncryptionSecret          string            `env:"JWE_SECRET, default="`                         // Base64url encoded 256-bit shared key for dir
+	KeyBackend                string            `env:"JWT_KEY_BACKEND, default=pem"`                 // Backend holding the signing keys: pem, pkcs11 or vault
+	InlineKeys                string            `env:"JWT_KEYS, default="`                           // PEM keys loaded in addition to the keys directory
+	KeyPassphrase             string            `env:"JWT_KEY_PASSPHRASE, default="`                 // Passphrase of encrypted private keys
+	KeyReloadSeconds          int16             `env:"KEY_RELOAD_SECONDS, default=30"`               // Interval of checking the key backend for changes, 0 reloads on SIGHUP only
+	PKCS11Module              string            `env:"PKCS11_MODULE, default="`                      // Path of the PKCS#11 module library
+	PKCS11TokenLabel          string            `env:"PKCS11_TOKEN_LABEL, default="`                 // Label of the PKCS#11 token holding the keys
+	PKCS11PIN                 string            `env:"PKCS11_PIN, default="`                         // User PIN of the PKCS#11 token
+	PKCS11KeyLabel            string            `env:"PKCS11_KEY_LABEL, default="`                   // Label of the PKCS#11 keys, all keys of the token if empty
+	VaultAddr                 string            `env:"VAULT_ADDR, default="`                         // Address of the Vault Transit compatible signing service
+	VaultToken                string            `env:"VAULT_TOKEN, default="`                        // Vault token allowed to read and sign with the transit key
+	VaultTransitMount         string            `env:"VAULT_TRANSIT_MOUNT, default=transit"`         // Mount path of the transit secrets engine
+	VaultTransitKey           string            `env:"VAULT_TRANSIT_KEY, default="`                  // Name of the transit key, its latest version signs tokens
+	SigningKeyID              string            `env:"JWT_SIGNING_KEY_ID, default="`                 // ID of the key used to sign tokens, the newest private key if empty
+	SigningAlgorithm          string            `env:"JWT_SIGNING_ALGORITHM, default=RS512"`         // Token signing algorithm: RS512, PS256, ES256 or EdDSA
+	Keys                      *KeyRing          // Keys for signing and verifying tokens
+	EncryptionKey             *EncryptionKey    // Key for encrypting access tokens, nil if disabled
 }
 
-// Loads the configuration from environment variables and RSA key files.
-func LoadConfig(ctx context.Context, filename string, privateRsaKeyPath string, publicRsaKeyPath string) *Config {
+// Loads the configuration from environment variables and the keys from the configured backend,
+// the key files in keysDir for the pem backend.
+func LoadConfig(ctx context.Context, filename string, keysDir string) *Config {
 	if err := godotenv.Load(filename); err != nil {
 		logrus.WithError(err).Fatal("Error loading .env file")
 	}
@@ -41,73 +99,109 @@ func LoadConfig(ctx context.Context, filename string, privateRsaKeyPath string,
 
 	v := reflect.ValueOf(cfg)
 	for field_idx := range v.NumField() {
+		envTag := v.Type().Field(field_idx).Tag.Get("env")
+		if envTag == "" || strings.Contains(envTag, "default=") {
+			continue
+		}
 		if v.Field(field_idx).IsZero() {
-			logrus.Fatalf("Missing required environment variable: %s", v.Type().Field(field_idx).Tag.Get("env"))
+			logrus.Fatalf("Missing required environment variable: %s", envTag)
 		}
 	}
 
-	rsaPrivateKey, err := loadPrivateKey(privateRsaKeyPath)
-	if err != nil {
-		logrus.WithError(err).Fatal("Error load private rsa key")
+	if !slices.Contains([]string{AccessTokenFormatJWT, AccessTokenFormatOpaque, AccessTokenFormatPASETO}, cfg.AccessTokenFormat) {
+		logrus.Fatalf("Unsupported access token format: %s", cfg.AccessTokenFormat)
 	}
-
-	rsaPublicKey, err := loadPublicKey(publicRsaKeyPath)
-	if err != nil {
-		logrus.WithError(err).Fatal("Error load public rsa key")
+	if cfg.AccessTokenFormat == AccessTokenFormatPASETO && cfg.SigningAlgorithm != AlgorithmEdDSA {
+		logrus.Fatalf("Access token format %s requires the %s signing algorithm", AccessTokenFormatPASETO, AlgorithmEdDSA)
 	}
 
-	cfg.RSAPrivateKey = rsaPrivateKey
-	cfg.RSAPublicKey = rsaPublicKey
+	// Tokens revoked by other replicas are loaded and expired entries are pruned on every sync
+	if cfg.DenylistSyncSeconds <= 0 {
+		logrus.Fatalf("DENYLIST_SYNC_SECONDS must be positive, got %d", cfg.DenylistSyncSeconds)
+	}
 
-	return &cfg
-}
+	if !slices.Contains([]string{SessionLimitPolicyReject, SessionLimitPolicyEvict}, cfg.SessionLimitPolicy) {
+		logrus.Fatalf("Unsupported session limit policy: %s", cfg.SessionLimitPolicy)
+	}
 
-// Reads and parses the RSA private key from a file.
-func loadPrivateKey(privateKeyPath string) (*rsa.PrivateKey, error) {
-	privKeyData, err := os.ReadFile(privateKeyPath)
+	keySource, err := NewKeySource(&cfg, keysDir)
 	if err != nil {
-		return nil, fmt.Errorf("error reading private key file: %v", err)
+		logrus.WithError(err).Fatal("Error open key backend")
 	}
-
-	block, _ := pem.Decode(privKeyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing the private key")
+	keyRing, err := LoadKeyRing(keySource, cfg.SigningKeyID, cfg.SigningAlgorithm, cfg.KeyRetention())
+	if err != nil {
+		logrus.WithError(err).Fatal("Error load keys")
 	}
+	cfg.Keys = keyRing
 
-	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if cfg.EncryptionAlgorithm != "" && cfg.AccessTokenFormat != AccessTokenFormatJWT {
+		logrus.Fatalf("Access token encryption requires the %s access token format", AccessTokenFormatJWT)
+	}
+	encryptionKey, err := LoadEncryptionKey(cfg.EncryptionAlgorithm, cfg.EncryptionKeyFile, cfg.EncryptionSecret)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing PKCS#8 private key: %v", err)
+		logrus.WithError(err).Fatal("Error load encryption key")
 	}
-
-	rsaPrivKey, ok := privKey.(*rsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("private key is not of type *rsa.PrivateKey")
+	if encryptionKey != nil && !encryptionKey.CanDecrypt() {
+		// The service validates the access tokens it issues, so it has to decrypt them too
+		logrus.Fatalf("Access token encryption with %s requires a private key in JWE_KEY_FILE", encryptionKey.Algorithm)
 	}
+	cfg.EncryptionKey = encryptionKey
 
-	return rsaPrivKey, nil
+	return &cfg
 }
 
-// Reads and parses the RSA public key from a file.
-func loadPublicKey(publicKeyPath string) (*rsa.PublicKey, error) {
-	pubKeyData, err := os.ReadFile(publicKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading public key file: %v", err)
-	}
+// Returns how long a retired key stays valid for verification.
+// Expired access tokens are still accepted on refresh, so the longer lifetime is used.
+func (c *Config) KeyRetention() time.Duration {
+	return time.Duration(max(c.AccessTokenExpireMinutes, c.RefreshTokenExpireMinutes)) * time.Minute
+}
 
-	block, _ := pem.Decode(pubKeyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing the public key")
+// Computes the RFC 7638 JWK thumbprint of the public key, used as a stable key ID and DPoP key binding.
+func KeyThumbprint(publicKey crypto.PublicKey) (string, error) {
+	params, err := JWKParams(publicKey)
+	if err != nil {
+		return "", err
 	}
 
-	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	// Map keys are marshaled in lexicographic order as required by RFC 7638
+	jwk, err := json.Marshal(params)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing PKIX public key: %v", err)
+		return "", err
 	}
 
-	rsaPubKey, ok := pubKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("public key is not of type *rsa.PublicKey")
-	}
+	sum := sha256.Sum256(jwk)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
 
-	return rsaPubKey, nil
+// Returns the required members of the public key JWK representation (RFC 7518 section 6, RFC 8037).
+func JWKParams(publicKey crypto.PublicKey) (map[string]string, error) {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		return map[string]string{
+			"kty": "EC",
+			"crv": pub.Curve.Params().Name,
+			"x":   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+			"y":   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", publicKey)
 }
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// Supported access token key management algorithms (RFC 7518 section 4)
+const (
+	EncryptionAlgorithmRSAOAEP256 = "RSA-OAEP-256" // Content key encrypted to the resource servers' RSA key
+	EncryptionAlgorithmDir        = "dir"          // Shared symmetric key used directly as the content key
+)
+
+// Key access tokens are encrypted with (nested JWT, RFC 7519 section 5.2).
+type EncryptionKey struct {
+	ID         string          // Key ID (RFC 7638 thumbprint of the RSA public key), empty for shared keys
+	Algorithm  string          // Key management algorithm
+	PublicKey  *rsa.PublicKey  // Resource servers' public key for RSA-OAEP-256
+	PrivateKey *rsa.PrivateKey // Private key for RSA-OAEP-256, nil when this service only encrypts
+	Secret     []byte          // 256-bit shared key for dir
+}
+
+// Loads the key access tokens are encrypted with, returns nil when encryption is disabled.
+// For RSA-OAEP-256 keyFile holds the resource servers' public key, or their private key
+// when this service has to decrypt tokens too. For dir the secret is the base64url encoded shared key.
+func LoadEncryptionKey(algorithm string, keyFile string, secret string) (*EncryptionKey, error) {
+	switch algorithm {
+	case "":
+		return nil, nil
+	case EncryptionAlgorithmRSAOAEP256:
+		keyData, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading encryption key file: %v", err)
+		}
+
+		privateKey, publicKey, err := parseKey(keyData, "")
+		if err != nil {
+			return nil, err
+		}
+		rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires an RSA key", algorithm)
+		}
+
+		key := &EncryptionKey{Algorithm: algorithm, PublicKey: rsaPublicKey}
+		if privateKey != nil {
+			key.PrivateKey = privateKey.(*rsa.PrivateKey)
+		}
+
+		key.ID, err = KeyThumbprint(key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case EncryptionAlgorithmDir:
+		sharedKey, err := base64.RawURLEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding encryption secret: %v", err)
+		}
+		if len(sharedKey) != 32 {
+			return nil, fmt.Errorf("encryption secret must be 256 bits, got %d", len(sharedKey)*8)
+		}
+		return &EncryptionKey{Algorithm: algorithm, Secret: sharedKey}, nil
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm: %s", algorithm)
+}
+
+// Reports whether tokens encrypted with the key can be decrypted by this service.
+func (k *EncryptionKey) CanDecrypt() bool {
+	return k.PrivateKey != nil || k.Secret != nil
+}
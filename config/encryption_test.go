@@ -0,0 +1,44 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEncryptionKeyRSA(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "resource-servers.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	assert.NoError(t, err)
+
+	key, err := LoadEncryptionKey(EncryptionAlgorithmRSAOAEP256, path, "")
+	assert.NoError(t, err)
+	assert.Equal(t, mustThumbprint(t, &privateKey.PublicKey), key.ID)
+	assert.True(t, privateKey.PublicKey.Equal(key.PublicKey))
+	assert.False(t, key.CanDecrypt())
+}
+
+func TestLoadEncryptionKeyDir(t *testing.T) {
+	key, err := LoadEncryptionKey(EncryptionAlgorithmDir, "", base64.RawURLEncoding.EncodeToString(make([]byte, 32)))
+	assert.NoError(t, err)
+	assert.True(t, key.CanDecrypt())
+
+	_, err = LoadEncryptionKey(EncryptionAlgorithmDir, "", base64.RawURLEncoding.EncodeToString(make([]byte, 16)))
+	assert.EqualError(t, err, "encryption secret must be 256 bits, got 128")
+
+	key, err = LoadEncryptionKey("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+}
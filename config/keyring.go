@@ -0,0 +1,306 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Supported token signing algorithms
+const (
+	AlgorithmRS512 = "RS512"
+	AlgorithmPS256 = "PS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key used to sign or verify access tokens.
+type Key struct {
+	ID          string           // Key ID (RFC 7638 thumbprint of the public key)
+	Algorithm   string           // Algorithm used to sign tokens with the key
+	PrivateKey  crypto.Signer    // Signs with the private key, which may be held by an HSM or a remote service; nil for verify-only keys
+	PublicKey   crypto.PublicKey // Public key for verifying tokens
+	ActivatedAt time.Time        // Modification time of the key file or creation time of the key version
+	removedAt   time.Time        // Time the key was removed from the source, zero while it is loaded
+}
+
+// Reports whether tokens signed with the algorithm can be verified with the key.
+// RSA keys accept both PKCS#1 v1.5 and PSS signatures, so the RSA algorithm can be switched without rotating keys.
+func (k *Key) AcceptsAlgorithm(alg string) bool {
+	switch k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return alg == AlgorithmRS512 || alg == AlgorithmPS256
+	case *ecdsa.PublicKey:
+		return alg == AlgorithmES256
+	case ed25519.PublicKey:
+		return alg == AlgorithmEdDSA
+	}
+	return false
+}
+
+// Set of keys with one current signing key and any number of verify-only keys.
+// The keys can be reloaded while in use, readers always see a consistent set.
+type KeyRing struct {
+	source       KeySource
+	signingKeyID string
+	algorithm    string
+	retention    time.Duration
+	set          atomic.Pointer[keySet]
+	reloadMu     sync.Mutex
+}
+
+// Snapshot of the keys of a key ring, never modified after it is published.
+type keySet struct {
+	current      *Key
+	signingSince time.Time // Time the current key started signing, older keys are retained from then
+	keys         map[string]*Key
+}
+
+// Loads the keys of the source into a key ring.
+//
+// The key with signingKeyID becomes the current signing key; when it is empty the newest
+// private key usable with the signing algorithm is used. Older keys stay valid for verification for the retention period
+// after the current key started signing, so tokens signed before a rotation keep working
+// until they expire.
+func LoadKeyRing(source KeySource, signingKeyID string, algorithm string, retention time.Duration) (*KeyRing, error) {
+	if !slices.Contains([]string{AlgorithmRS512, AlgorithmPS256, AlgorithmES256, AlgorithmEdDSA}, algorithm) {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	ring := &KeyRing{source: source, signingKeyID: signingKeyID, algorithm: algorithm, retention: retention}
+	set, err := ring.load(nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ring.set.Store(set)
+
+	return ring, nil
+}
+
+// Reloads the keys from their source and swaps them in at once.
+// Keys removed from the source stay valid for verification for the retention period,
+// so tokens signed before the removal keep working until they expire.
+// On error the current keys are kept.
+func (r *KeyRing) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	previous := r.set.Load()
+	set, err := r.load(previous, time.Now())
+	if err != nil {
+		return err
+	}
+	r.set.Store(set)
+
+	for keyID, key := range set.keys {
+		if _, ok := previous.keys[keyID]; !ok {
+			logrus.Infof("Loaded %s key %s", key.Algorithm, keyID)
+		} else if key.removedAt != previous.keys[keyID].removedAt {
+			logrus.Infof("Key %s removed, it is accepted for verification until %s", keyID, key.removedAt.Add(r.retention).Format(time.RFC3339))
+		}
+	}
+	if set.current.ID != previous.current.ID {
+		logrus.Infof("Signing key changed from %s to %s", previous.current.ID, set.current.ID)
+	}
+
+	return nil
+}
+
+// Reloads the keys on SIGHUP and, if interval is positive, whenever the key source reports a change.
+func (r *KeyRing) StartReload(interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	state := r.source.State()
+	var changes <-chan time.Time
+	if interval > 0 && state != "" {
+		changes = time.Tick(interval)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				logrus.Info("Reloading keys on SIGHUP")
+			case <-changes:
+				current := r.source.State()
+				if current == "" || current == state {
+					continue
+				}
+				logrus.Info("Reloading keys after the key source changed")
+			}
+
+			state = r.source.State()
+			if err := r.Reload(); err != nil {
+				logrus.WithError(err).Error("Failed reload keys, the previous keys are kept")
+			}
+		}
+	}()
+}
+
+// Loads the keys from the source and selects the signing key.
+// Activation times of known keys are kept, keys missing from the source are carried over as verify-only keys.
+func (r *KeyRing) load(previous *keySet, now time.Time) (*keySet, error) {
+	keys, err := r.source.LoadKeys(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &keySet{keys: make(map[string]*Key)}
+	for _, key := range keys {
+		if previous != nil {
+			if known, ok := previous.keys[key.ID]; ok && known.removedAt.IsZero() && known.ActivatedAt.Before(key.ActivatedAt) {
+				key.ActivatedAt = known.ActivatedAt
+			}
+		}
+
+		existing, ok := set.keys[key.ID]
+		if !ok {
+			set.keys[key.ID] = key
+			continue
+		}
+		if existing.PrivateKey == nil && key.PrivateKey != nil {
+			// A pre-published key can sign from the time its private key was added
+			existing.PrivateKey = key.PrivateKey
+			existing.ActivatedAt = key.ActivatedAt
+		} else if (existing.PrivateKey == nil) == (key.PrivateKey == nil) && key.ActivatedAt.Before(existing.ActivatedAt) {
+			existing.ActivatedAt = key.ActivatedAt
+		}
+	}
+
+	if r.signingKeyID != "" {
+		key, ok := set.keys[r.signingKeyID]
+		if !ok || key.PrivateKey == nil {
+			return nil, fmt.Errorf("private key %s not found", r.signingKeyID)
+		}
+		if key.Algorithm != r.algorithm {
+			return nil, fmt.Errorf("key %s cannot be used with the %s algorithm", r.signingKeyID, r.algorithm)
+		}
+		set.current = key
+	} else {
+		for _, key := range set.keys {
+			if key.PrivateKey == nil || key.Algorithm != r.algorithm {
+				continue
+			}
+			if set.current == nil || key.ActivatedAt.After(set.current.ActivatedAt) {
+				set.current = key
+			}
+		}
+	}
+
+	if set.current == nil {
+		return nil, fmt.Errorf("no private key for the %s algorithm found", r.algorithm)
+	}
+
+	// The activation time of a key may be older than its private key, e.g. kept from its pre-published public key,
+	// so a key that becomes current on reload is measured from now
+	switch {
+	case previous == nil:
+		set.signingSince = set.current.ActivatedAt
+	case previous.current.ID == set.current.ID:
+		set.signingSince = previous.signingSince
+	default:
+		set.signingSince = now
+	}
+
+	if previous != nil {
+		for keyID, key := range previous.keys {
+			if _, ok := set.keys[keyID]; ok {
+				continue
+			}
+			removed := *key
+			removed.PrivateKey = nil
+			if removed.removedAt.IsZero() {
+				removed.removedAt = now
+			}
+			if set.isActive(&removed, now, r.retention) {
+				set.keys[keyID] = &removed
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// Returns the key used to sign new tokens.
+func (r *KeyRing) SigningKey() *Key {
+	return r.set.Load().current
+}
+
+// Returns the verification key with the given ID if it has not been retired.
+func (r *KeyRing) VerificationKey(keyID string) (*Key, error) {
+	set := r.set.Load()
+	key, ok := set.keys[keyID]
+	if !ok || !set.isActive(key, time.Now(), r.retention) {
+		return nil, fmt.Errorf("unknown key ID: %s", keyID)
+	}
+	return key, nil
+}
+
+// Returns all keys currently accepted for verification, the signing key first.
+func (r *KeyRing) VerificationKeys() []*Key {
+	set := r.set.Load()
+	now := time.Now()
+
+	keys := []*Key{set.current}
+	for _, key := range set.keys {
+		if key != set.current && set.isActive(key, now, r.retention) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.SliceStable(keys[1:], func(i, j int) bool {
+		return keys[i+1].ActivatedAt.After(keys[j+1].ActivatedAt)
+	})
+
+	return keys
+}
+
+// Reports whether tokens signed with the key could still be valid.
+// Keys newer than the signing key are pre-published and always accepted, older keys for the retention period
+// after the signing key started signing, keys removed from the source for the retention period after their removal.
+func (s *keySet) isActive(key *Key, now time.Time, retention time.Duration) bool {
+	if !key.removedAt.IsZero() {
+		return now.Before(key.removedAt.Add(retention))
+	}
+	if key == s.current || key.ActivatedAt.After(s.current.ActivatedAt) {
+		return true
+	}
+	return now.Before(s.signingSince.Add(retention))
+}
+
+// Creates a key identified by its thumbprint.
+// RSA keys are assigned the configured algorithm when it is an RSA one.
+func newKey(privateKey crypto.Signer, publicKey crypto.PublicKey, activatedAt time.Time, rsaAlgorithm string) (*Key, error) {
+	keyID, err := KeyThumbprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: keyID, PrivateKey: privateKey, PublicKey: publicKey, ActivatedAt: activatedAt}
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgorithmRS512
+		if rsaAlgorithm == AlgorithmPS256 {
+			key.Algorithm = AlgorithmPS256
+		}
+	case *ecdsa.PublicKey:
+		key.Algorithm = AlgorithmES256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgorithmEdDSA
+	}
+
+	return key, nil
+}
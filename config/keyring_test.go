@@ -0,0 +1,205 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustThumbprint(t *testing.T, publicKey crypto.PublicKey) string {
+	keyID, err := KeyThumbprint(publicKey)
+	assert.NoError(t, err)
+	return keyID
+}
+
+func writeTestKey(t *testing.T, dir string, name string, modTime time.Time, withPrivate bool) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var block *pem.Block
+	if withPrivate {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	return privateKey
+}
+
+func TestLoadKeyRingSelectsNewestPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeTestKey(t, dir, "old.pem", now.Add(-time.Hour), true)
+	newest := writeTestKey(t, dir, "new.pem", now.Add(-time.Minute), true)
+	staged := writeTestKey(t, dir, "staged.pem", now, false)
+
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ring.SigningKey().PublicKey.(*rsa.PublicKey).Equal(&newest.PublicKey))
+
+	// Pre-published public keys are accepted before they start signing
+	_, err = ring.VerificationKey(mustThumbprint(t, &staged.PublicKey))
+	assert.NoError(t, err)
+	assert.Len(t, ring.VerificationKeys(), 3)
+}
+
+func TestLoadKeyRingRetiresOldKeys(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	old := writeTestKey(t, dir, "old.pem", now.Add(-2*time.Hour), true)
+	writeTestKey(t, dir, "new.pem", now.Add(-time.Hour), true)
+
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, 10*time.Minute)
+	assert.NoError(t, err)
+
+	_, err = ring.VerificationKey(mustThumbprint(t, &old.PublicKey))
+	assert.Error(t, err)
+	assert.Len(t, ring.VerificationKeys(), 1)
+}
+
+func TestLoadKeyRingExplicitSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	pinned := writeTestKey(t, dir, "pinned.pem", now.Add(-time.Hour), true)
+	writeTestKey(t, dir, "new.pem", now, true)
+
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, mustThumbprint(t, &pinned.PublicKey), AlgorithmRS512, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ring.SigningKey().PublicKey.(*rsa.PublicKey).Equal(&pinned.PublicKey))
+
+	_, err = LoadKeyRing(PEMKeySource{Dir: dir}, "unknown", AlgorithmRS512, 10*time.Minute)
+	assert.Error(t, err)
+}
+
+func TestLoadKeyRingSelectsKeyByAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeTestKey(t, dir, "rsa.pem", now, true)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for name, privateKey := range map[string]crypto.Signer{"ec.pem": ecKey, "ed.pem": edKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		assert.NoError(t, err)
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+		assert.NoError(t, os.Chtimes(path, now.Add(-time.Minute), now.Add(-time.Minute)))
+	}
+
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmES256, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmES256, ring.SigningKey().Algorithm)
+	assert.True(t, ring.SigningKey().PublicKey.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey))
+
+	ring, err = LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmEdDSA, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmEdDSA, ring.SigningKey().Algorithm)
+
+	ring, err = LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmPS256, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmPS256, ring.SigningKey().Algorithm)
+
+	_, err = LoadKeyRing(PEMKeySource{Dir: dir}, "", "HS256", 10*time.Minute)
+	assert.Error(t, err)
+}
+
+func TestKeyRingReload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	old := writeTestKey(t, dir, "old.pem", now.Add(-time.Hour), true)
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, 10*time.Minute)
+	assert.NoError(t, err)
+
+	// The rotated key replaces the old one, which is still accepted for verification
+	rotated := writeTestKey(t, dir, "rotated.pem", now, true)
+	assert.NoError(t, os.Remove(filepath.Join(dir, "old.pem")))
+	assert.NoError(t, ring.Reload())
+	assert.Equal(t, mustThumbprint(t, &rotated.PublicKey), ring.SigningKey().ID)
+
+	oldKey, err := ring.VerificationKey(mustThumbprint(t, &old.PublicKey))
+	assert.NoError(t, err)
+	assert.Nil(t, oldKey.PrivateKey)
+	assert.Len(t, ring.VerificationKeys(), 2)
+
+	// A broken key file keeps the current keys
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0600))
+	assert.Error(t, ring.Reload())
+	assert.Equal(t, mustThumbprint(t, &rotated.PublicKey), ring.SigningKey().ID)
+}
+
+func TestKeyRingReloadDropsRemovedKeysAfterRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	old := writeTestKey(t, dir, "old.pem", now.Add(-time.Hour), true)
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, 0)
+	assert.NoError(t, err)
+
+	writeTestKey(t, dir, "rotated.pem", now, true)
+	assert.NoError(t, os.Remove(filepath.Join(dir, "old.pem")))
+	assert.NoError(t, ring.Reload())
+
+	_, err = ring.VerificationKey(mustThumbprint(t, &old.PublicKey))
+	assert.Error(t, err)
+	assert.Len(t, ring.VerificationKeys(), 1)
+}
+
+func TestKeyRingReloadRetainsOldKeyAfterPrePublishedRotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	old := writeTestKey(t, dir, "old.pem", now.Add(-48*time.Hour), true)
+	ring, err := LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, time.Hour)
+	assert.NoError(t, err)
+
+	// Step 1: the public key of the next key is published a day before it signs
+	next := writeTestKey(t, dir, "next-public.pem", now.Add(-24*time.Hour), false)
+	assert.NoError(t, ring.Reload())
+	assert.Equal(t, mustThumbprint(t, &old.PublicKey), ring.SigningKey().ID)
+
+	// Step 2: its private key is added and it starts signing
+	der, err := x509.MarshalPKCS8PrivateKey(next)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "next-private.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	assert.NoError(t, err)
+	assert.NoError(t, ring.Reload())
+	assert.Equal(t, mustThumbprint(t, &next.PublicKey), ring.SigningKey().ID)
+
+	// Tokens of the old key stay valid for the retention period from the rotation
+	_, err = ring.VerificationKey(mustThumbprint(t, &old.PublicKey))
+	assert.NoError(t, err)
+
+	// Also when the service starts after the rotation
+	ring, err = LoadKeyRing(PEMKeySource{Dir: dir}, "", AlgorithmRS512, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, mustThumbprint(t, &next.PublicKey), ring.SigningKey().ID)
+	_, err = ring.VerificationKey(mustThumbprint(t, &old.PublicKey))
+	assert.NoError(t, err)
+}
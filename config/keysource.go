@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Key backends
+const (
+	KeyBackendPEM    = "pem"    // PEM files in the keys directory and inline PEM keys
+	KeyBackendPKCS11 = "pkcs11" // Keys held by a PKCS#11 token, private keys never leave the token
+	KeyBackendVault  = "vault"  // Keys of a HashiCorp Vault Transit compatible signing service
+)
+
+// Backend holding the keys of a key ring.
+// Private keys are exposed as crypto.Signers, so a backend can keep them out of the process.
+type KeySource interface {
+	// Loads the private and public keys, the private key is nil for verify-only keys.
+	LoadKeys(rsaAlgorithm string) ([]*Key, error)
+	// Describes the keys to detect changes, empty if changes cannot be detected.
+	State() string
+}
+
+// Creates the key source selected by the configuration.
+func NewKeySource(cfg *Config, keysDir string) (KeySource, error) {
+	switch cfg.KeyBackend {
+	case KeyBackendPEM:
+		return PEMKeySource{Dir: keysDir, Inline: cfg.InlineKeys, Passphrase: cfg.KeyPassphrase}, nil
+	case KeyBackendPKCS11:
+		return NewPKCS11KeySource(cfg.PKCS11Module, cfg.PKCS11TokenLabel, cfg.PKCS11PIN, cfg.PKCS11KeyLabel)
+	case KeyBackendVault:
+		if cfg.VaultAddr == "" || cfg.VaultTransitKey == "" {
+			return nil, fmt.Errorf("VAULT_ADDR and VAULT_TRANSIT_KEY are required for the %s key backend", KeyBackendVault)
+		}
+		return NewVaultKeySource(cfg.VaultAddr, cfg.VaultToken, cfg.VaultTransitMount, cfg.VaultTransitKey), nil
+	}
+	return nil, fmt.Errorf("unsupported key backend: %s", cfg.KeyBackend)
+}
+
+// PEM keys from a directory and the environment.
+type PEMKeySource struct {
+	Dir        string // Directory with one PEM key per *.pem file
+	Inline     string // PEM keys from the environment, treated as activated at load time
+	Passphrase string // Passphrase of encrypted private keys
+}
+
+// Reads the keys of the key files and the inline keys.
+func (s PEMKeySource) LoadKeys(rsaAlgorithm string) ([]*Key, error) {
+	var keys []*Key
+
+	if s.Dir != "" {
+		paths, err := filepath.Glob(filepath.Join(s.Dir, "*.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing keys directory: %v", err)
+		}
+
+		for _, path := range paths {
+			key, err := loadKey(path, s.Passphrase, rsaAlgorithm)
+			if err != nil {
+				return nil, fmt.Errorf("error loading key %s: %v", path, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	loadedAt := time.Now()
+	rest := []byte(s.Inline)
+	for index := 1; ; index++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "EC PARAMETERS" {
+			continue
+		}
+
+		privateKey, publicKey, err := parseKeyBlock(block, s.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error loading inline key %d: %v", index, err)
+		}
+		key, err := newKey(privateKey, publicKey, loadedAt, rsaAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Describes the key files by name, size and modification time.
+// Inline keys only change on restart and are not described.
+func (s PEMKeySource) State() string {
+	if s.Dir == "" {
+		return ""
+	}
+
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.pem"))
+	if err != nil {
+		return ""
+	}
+
+	var state strings.Builder
+	state.WriteString(s.Dir + "\n")
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&state, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return state.String()
+}
+
+// Reads a private or public key from a PEM file, activated at the modification time of the file.
+func loadKey(path string, passphrase string, rsaAlgorithm string) (*Key, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+
+	privateKey, publicKey, err := parseKey(keyData, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(privateKey, publicKey, info.ModTime(), rsaAlgorithm)
+}
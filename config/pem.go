@@ -0,0 +1,225 @@
+package config
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash"
+)
+
+// Parses the first key of the PEM data, see parseKeyBlock.
+func parseKey(data []byte, passphrase string) (crypto.Signer, crypto.PublicKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, nil, fmt.Errorf("failed to parse PEM block containing the key")
+		}
+		// Written before SEC1 keys by "openssl ecparam -genkey"
+		if block.Type == "EC PARAMETERS" {
+			continue
+		}
+		return parseKeyBlock(block, passphrase)
+	}
+}
+
+// Parses a private or public key PEM block. The private key is nil for public keys.
+// Private keys are accepted in PKCS#8, PKCS#1 (RSA) and SEC1 (EC) format, encrypted with the passphrase
+// either as PKCS#8 PBES2 or with the legacy OpenSSL "Proc-Type: 4,ENCRYPTED" headers.
+// Public keys are accepted in PKIX and PKCS#1 format.
+func parseKeyBlock(block *pem.Block, passphrase string) (crypto.Signer, crypto.PublicKey, error) {
+	der := block.Bytes
+	// Legacy encryption is deprecated but still written by "openssl genrsa -aes256 -traditional"
+	if x509.IsEncryptedPEMBlock(block) {
+		if passphrase == "" {
+			return nil, nil, fmt.Errorf("key is encrypted, passphrase is not set")
+		}
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err != nil {
+			return nil, nil, fmt.Errorf("error decrypting key: %v", err)
+		}
+	}
+
+	var privateKey any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(der)
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, nil, fmt.Errorf("key is encrypted, passphrase is not set")
+		}
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return nil, nil, err
+		}
+		privateKey, err = x509.ParsePKCS8PrivateKey(der)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(der)
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing PKIX public key: %v", err)
+		}
+		return nil, publicKey, checkKeyType(publicKey)
+	case "RSA PUBLIC KEY":
+		publicKey, err := x509.ParsePKCS1PublicKey(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing PKCS#1 public key: %v", err)
+		}
+		return nil, publicKey, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %v", block.Type, err)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if err := checkKeyType(signer.Public()); err != nil {
+		return nil, nil, err
+	}
+
+	return signer, signer.Public(), nil
+}
+
+// Checks that the key can be used with one of the supported signing algorithms.
+func checkKeyType(publicKey crypto.PublicKey) error {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return fmt.Errorf("unsupported elliptic curve %s, only P-256 is supported", pub.Curve.Params().Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// EncryptedPrivateKeyInfo (RFC 5958 section 3)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// PBES2-params (RFC 8018 appendix A.4)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// PBKDF2-params (RFC 8018 appendix A.2)
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Decrypts a PKCS#8 private key encrypted with PBES2, PBKDF2 and AES-CBC,
+// the default of "openssl genpkey -aes256" and "openssl pkcs8 -topk8".
+func decryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("error parsing encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %v, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("error parsing PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("error parsing PBKDF2 parameters: %v", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case kdfParams.PRF.Algorithm == nil, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 function %v", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %v", params.EncryptionScheme.Algorithm)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid encryption scheme IV")
+	}
+
+	key, err := pbkdf2.Key(prf, passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key length")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// PKCS#7 padding, a wrong passphrase almost always leaves invalid padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("error decrypting key: incorrect passphrase")
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("error decrypting key: incorrect passphrase")
+		}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
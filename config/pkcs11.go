@@ -0,0 +1,312 @@
+//go:build pkcs11
+
+package config
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/pkcs11"
+)
+
+// Keys held by a PKCS#11 token, e.g. an HSM or SoftHSM.
+// RSA and P-256 key pairs with the configured label are loaded, public keys without
+// a private key on the token are verify-only. Private keys never leave the token.
+type PKCS11KeySource struct {
+	ctx      *pkcs11.Ctx
+	session  pkcs11.SessionHandle
+	keyLabel string
+	mu       sync.Mutex // PKCS#11 sessions must not be used concurrently
+}
+
+// Opens a session with the token labeled tokenLabel and logs in with the user PIN.
+func NewPKCS11KeySource(module string, tokenLabel string, pin string, keyLabel string) (KeySource, error) {
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("error loading PKCS#11 module %s", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("error initializing PKCS#11 module: %v", err)
+	}
+
+	session, err := openPKCS11Session(ctx, tokenLabel, pin)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+
+	return &PKCS11KeySource{ctx: ctx, session: session, keyLabel: keyLabel}, nil
+}
+
+func openPKCS11Session(ctx *pkcs11.Ctx, tokenLabel string, pin string) (pkcs11.SessionHandle, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("error listing PKCS#11 slots: %v", err)
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != tokenLabel {
+			continue
+		}
+
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return 0, fmt.Errorf("error opening PKCS#11 session: %v", err)
+		}
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+			ctx.CloseSession(session)
+			return 0, fmt.Errorf("error logging in to PKCS#11 token %s: %v", tokenLabel, err)
+		}
+		return session, nil
+	}
+
+	return 0, fmt.Errorf("PKCS#11 token %s not found", tokenLabel)
+}
+
+// Loads the public keys with the key label and binds them to the private keys with the same CKA_ID.
+// Keys are activated at their CKA_START_DATE, or when they are loaded first if it is not set.
+func (s *PKCS11KeySource) LoadKeys(rsaAlgorithm string) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	publicKeys, err := s.findObjects(pkcs11.CKO_PUBLIC_KEY, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	loadedAt := time.Now()
+	var keys []*Key
+	for _, object := range publicKeys {
+		attributes, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_ID, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_START_DATE, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading PKCS#11 public key: %v", err)
+		}
+		id, keyType, startDate := attributes[0].Value, pkcs11Uint(attributes[1].Value), attributes[2].Value
+
+		publicKey, err := s.publicKey(object, keyType)
+		if err != nil {
+			return nil, fmt.Errorf("error loading PKCS#11 key %x: %v", id, err)
+		}
+
+		var signer crypto.Signer
+		privateKeys, err := s.findObjects(pkcs11.CKO_PRIVATE_KEY, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(privateKeys) > 0 {
+			signer = &pkcs11Signer{source: s, object: privateKeys[0], publicKey: publicKey}
+		}
+
+		activatedAt := loadedAt
+		if date, err := time.Parse("20060102", string(startDate)); err == nil {
+			activatedAt = date
+		}
+
+		key, err := newKey(signer, publicKey, activatedAt, rsaAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Describes the IDs of the public keys, so keys added to the token are picked up.
+func (s *PKCS11KeySource) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.findObjects(pkcs11.CKO_PUBLIC_KEY, nil)
+	if err != nil {
+		return ""
+	}
+
+	var ids []string
+	for _, object := range objects {
+		attributes, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ID, nil)})
+		if err != nil {
+			return ""
+		}
+		ids = append(ids, hex.EncodeToString(attributes[0].Value))
+	}
+	slices.Sort(ids)
+	return "pkcs11 " + strings.Join(ids, " ")
+}
+
+// Finds the objects of the class with the key label, and the ID if not nil.
+func (s *PKCS11KeySource) findObjects(class uint, id []byte) ([]pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if s.keyLabel != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, s.keyLabel))
+	}
+	if id != nil {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, id))
+	}
+
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return nil, fmt.Errorf("error searching PKCS#11 objects: %v", err)
+	}
+	defer s.ctx.FindObjectsFinal(s.session)
+
+	var objects []pkcs11.ObjectHandle
+	for {
+		found, _, err := s.ctx.FindObjects(s.session, 100)
+		if err != nil {
+			return nil, fmt.Errorf("error searching PKCS#11 objects: %v", err)
+		}
+		if len(found) == 0 {
+			return objects, nil
+		}
+		objects = append(objects, found...)
+	}
+}
+
+// Reads the public key from the attributes of the object.
+func (s *PKCS11KeySource) publicKey(object pkcs11.ObjectHandle, keyType uint) (crypto.PublicKey, error) {
+	switch keyType {
+	case pkcs11.CKK_RSA:
+		attributes, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attributes[0].Value),
+			E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+		}, nil
+	case pkcs11.CKK_EC:
+		attributes, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attributes[0].Value, &curve); err != nil || !curve.Equal(oidNamedCurveP256) {
+			return nil, fmt.Errorf("unsupported elliptic curve, only P-256 is supported")
+		}
+
+		// The point is usually wrapped in a DER OCTET STRING
+		point := attributes[1].Value
+		var unwrapped []byte
+		if rest, err := asn1.Unmarshal(point, &unwrapped); err == nil && len(rest) == 0 {
+			point = unwrapped
+		}
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid P-256 public key: %v", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported PKCS#11 key type %d", keyType)
+}
+
+var oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+// Decodes a CK_ULONG attribute value.
+func pkcs11Uint(value []byte) uint {
+	switch len(value) {
+	case 8:
+		return uint(binary.NativeEndian.Uint64(value))
+	case 4:
+		return uint(binary.NativeEndian.Uint32(value))
+	}
+	return ^uint(0)
+}
+
+// Signs with a private key of the token.
+type pkcs11Signer struct {
+	source    *PKCS11KeySource
+	object    pkcs11.ObjectHandle
+	publicKey crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Signs the digest the same way as the crypto.Signer of a local key:
+// PKCS#1 v1.5 or PSS signatures for RSA keys depending on opts, ASN.1 encoded signatures for ECDSA keys.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := pkcs11Hashes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+
+	var mechanism *pkcs11.Mechanism
+	input := digest
+	switch s.publicKey.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			params := pkcs11.NewPSSParams(hash.mechanism, hash.mgf, uint(opts.HashFunc().Size()))
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params)
+		} else {
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+			input = append(slices.Clone(hash.digestInfo), digest...)
+		}
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", s.publicKey)
+	}
+
+	s.source.mu.Lock()
+	defer s.source.mu.Unlock()
+
+	if err := s.source.ctx.SignInit(s.source.session, []*pkcs11.Mechanism{mechanism}, s.object); err != nil {
+		return nil, fmt.Errorf("error signing with PKCS#11 key: %v", err)
+	}
+	signature, err := s.source.ctx.Sign(s.source.session, input)
+	if err != nil {
+		return nil, fmt.Errorf("error signing with PKCS#11 key: %v", err)
+	}
+
+	if _, ok := s.publicKey.(*ecdsa.PublicKey); ok {
+		// CKM_ECDSA returns r || s
+		size := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature[:size]),
+			S: new(big.Int).SetBytes(signature[size:]),
+		})
+	}
+	return signature, nil
+}
+
+// PKCS#11 parameters of the supported hash functions.
+var pkcs11Hashes = map[crypto.Hash]struct {
+	mechanism  uint
+	mgf        uint
+	digestInfo []byte // DER prefix of the DigestInfo signed by CKM_RSA_PKCS
+}{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384, []byte{0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30}},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512, []byte{0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40}},
+}
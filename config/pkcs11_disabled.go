@@ -0,0 +1,10 @@
+//go:build !pkcs11
+
+package config
+
+import "fmt"
+
+// PKCS#11 support needs cgo and is only built with the pkcs11 build tag.
+func NewPKCS11KeySource(module string, tokenLabel string, pin string, keyLabel string) (KeySource, error) {
+	return nil, fmt.Errorf("PKCS#11 support is not built in, build with -tags pkcs11")
+}
@@ -0,0 +1,90 @@
+//go:build pkcs11
+
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs against SoftHSM, e.g.:
+//
+//	softhsm2-util --init-token --free --label test --pin 1234 --so-pin 1234
+//	PKCS11_TEST_MODULE=/usr/lib/softhsm/libsofthsm2.so go test -tags pkcs11 ./config
+func setupPKCS11Source(t *testing.T) *PKCS11KeySource {
+	module := os.Getenv("PKCS11_TEST_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_TEST_MODULE is not set")
+	}
+
+	source, err := NewPKCS11KeySource(module, "test", "1234", "jwt-"+t.Name())
+	assert.NoError(t, err)
+	return source.(*PKCS11KeySource)
+}
+
+func generatePKCS11KeyPair(t *testing.T, source *PKCS11KeySource, mechanism uint, publicTemplate []*pkcs11.Attribute) {
+	id := []byte(time.Now().Format(time.RFC3339Nano))
+	common := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, source.keyLabel),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+
+	_, _, err := source.ctx.GenerateKeyPair(source.session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)},
+		append(append(common, pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true)), publicTemplate...),
+		append(common, pkcs11.NewAttribute(pkcs11.CKA_SIGN, true), pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true)))
+	assert.NoError(t, err)
+}
+
+func TestPKCS11KeySourceRSA(t *testing.T) {
+	source := setupPKCS11Source(t)
+	generatePKCS11KeyPair(t, source, pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+	})
+
+	ring, err := LoadKeyRing(source, "", AlgorithmRS512, time.Hour)
+	assert.NoError(t, err)
+	signingKey := ring.SigningKey()
+	publicKey := signingKey.PublicKey.(*rsa.PublicKey)
+
+	digest := sha512.Sum512([]byte("signing input"))
+	signature, err := signingKey.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA512)
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA512, digest[:], signature))
+
+	pssDigest := sha256.Sum256([]byte("signing input"))
+	signature, err = signingKey.PrivateKey.Sign(rand.Reader, pssDigest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPSS(publicKey, crypto.SHA256, pssDigest[:], signature, nil))
+}
+
+func TestPKCS11KeySourceECDSA(t *testing.T) {
+	source := setupPKCS11Source(t)
+	curve, err := asn1.Marshal(oidNamedCurveP256)
+	assert.NoError(t, err)
+	generatePKCS11KeyPair(t, source, pkcs11.CKM_EC_KEY_PAIR_GEN, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, curve),
+	})
+
+	ring, err := LoadKeyRing(source, "", AlgorithmES256, time.Hour)
+	assert.NoError(t, err)
+	signingKey := ring.SigningKey()
+
+	digest := sha256.Sum256([]byte("signing input"))
+	signature, err := signingKey.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(signingKey.PublicKey.(*ecdsa.PublicKey), digest[:], signature))
+}
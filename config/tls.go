@@ -0,0 +1,34 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Builds the TLS configuration of the HTTP listener.
+// Client certificates are requested and verified against the CA bundle when one is configured,
+// clients without a certificate are still accepted and receive unbound tokens.
+func LoadTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caData, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA file: %v", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificates found in client CA file")
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of a HashiCorp Vault Transit compatible signing service.
+// Every version of the transit key is a separate key of the key ring: the latest version signs,
+// older versions stay valid for verification, so rotating the key in Vault rotates the signing key.
+type VaultKeySource struct {
+	Addr    string       // Address of the service, e.g. https://vault:8200
+	Token   string       // Token sent in the X-Vault-Token header
+	Mount   string       // Mount path of the transit secrets engine
+	KeyName string       // Name of the transit key
+	Client  *http.Client // HTTP client used for the requests
+}
+
+// Creates a source for the transit key mounted at mount, "transit" if empty.
+func NewVaultKeySource(addr string, token string, mount string, keyName string) *VaultKeySource {
+	if mount == "" {
+		mount = "transit"
+	}
+	return &VaultKeySource{
+		Addr:    strings.TrimSuffix(addr, "/"),
+		Token:   token,
+		Mount:   strings.Trim(mount, "/"),
+		KeyName: keyName,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Transit key as returned by GET /v1/<mount>/keys/<name>.
+type vaultKey struct {
+	Type          string `json:"type"`
+	LatestVersion int    `json:"latest_version"`
+	Keys          map[string]struct {
+		PublicKey    string    `json:"public_key"`
+		CreationTime time.Time `json:"creation_time"`
+	} `json:"keys"`
+}
+
+// Fetches the public keys of all key versions, the latest version signs through the service.
+func (s *VaultKeySource) LoadKeys(rsaAlgorithm string) ([]*Key, error) {
+	var transitKey vaultKey
+	if err := s.request(http.MethodGet, "keys/"+url.PathEscape(s.KeyName), nil, &transitKey); err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for version, keyVersion := range transitKey.Keys {
+		versionNumber, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q of transit key %s", version, s.KeyName)
+		}
+
+		publicKey, err := parseVaultPublicKey(transitKey.Type, keyVersion.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading version %d of transit key %s: %v", versionNumber, s.KeyName, err)
+		}
+
+		var signer crypto.Signer
+		if versionNumber == transitKey.LatestVersion {
+			signer = &vaultSigner{source: s, version: versionNumber, publicKey: publicKey}
+		}
+
+		key, err := newKey(signer, publicKey, keyVersion.CreationTime, rsaAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Describes the key versions, so rotating the transit key is picked up.
+func (s *VaultKeySource) State() string {
+	var transitKey vaultKey
+	if err := s.request(http.MethodGet, "keys/"+url.PathEscape(s.KeyName), nil, &transitKey); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d %d", transitKey.Type, transitKey.LatestVersion, len(transitKey.Keys))
+}
+
+// Sends a request to the transit engine and decodes the "data" member of the response.
+func (s *VaultKeySource) request(method string, path string, body any, data any) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s", s.Addr, s.Mount, path), requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Vault-Token", s.Token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %v", err)
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid vault response with status %d: %v", response.StatusCode, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault responded with status %d: %s", response.StatusCode, strings.Join(result.Errors, "; "))
+	}
+
+	return json.Unmarshal(result.Data, data)
+}
+
+// Parses the public key of a transit key version: PEM for RSA and ECDSA keys, base64 for Ed25519 keys.
+func parseVaultPublicKey(keyType string, publicKey string) (crypto.PublicKey, error) {
+	if keyType == "ed25519" {
+		raw, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, fmt.Errorf("unsupported %s key without a PEM public key", keyType)
+	}
+	_, key, err := parseKeyBlock(block, "")
+	return key, err
+}
+
+// Signs with a version of a transit key, the private key never leaves the service.
+type vaultSigner struct {
+	source    *VaultKeySource
+	version   int
+	publicKey crypto.PublicKey
+}
+
+func (s *vaultSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Signs the digest, or the message for Ed25519 keys, the same way as the crypto.Signer of a local key:
+// PKCS#1 v1.5 or PSS signatures for RSA keys depending on opts, ASN.1 encoded signatures for ECDSA keys.
+func (s *vaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	body := map[string]any{
+		"input":       base64.StdEncoding.EncodeToString(digest),
+		"key_version": s.version,
+	}
+	path := "sign/" + url.PathEscape(s.source.KeyName)
+
+	if _, ok := s.publicKey.(ed25519.PublicKey); !ok {
+		hashAlgorithm, ok := vaultHashAlgorithms[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+		}
+		path += "/" + hashAlgorithm
+		body["prehashed"] = true
+		body["marshaling_algorithm"] = "asn1"
+
+		if _, ok := s.publicKey.(*rsa.PublicKey); ok {
+			body["signature_algorithm"] = "pkcs1v15"
+			if _, ok := opts.(*rsa.PSSOptions); ok {
+				body["signature_algorithm"] = "pss"
+				body["salt_length"] = "hash"
+			}
+		}
+	}
+
+	var result struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.source.request(http.MethodPost, path, body, &result); err != nil {
+		return nil, err
+	}
+
+	// Signatures are returned as "vault:v<version>:<base64 signature>"
+	parts := strings.Split(result.Signature, ":")
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("invalid vault signature format")
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+var vaultHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
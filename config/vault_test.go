@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal stand-in for the Vault Transit sign and read key endpoints.
+type transitStub struct {
+	mu       sync.Mutex
+	keyType  string
+	versions []crypto.Signer
+}
+
+func (s *transitStub) rotate(t *testing.T) crypto.Signer {
+	var signer crypto.Signer
+	var err error
+	switch s.keyType {
+	case "rsa-2048":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa-p256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	assert.NoError(t, err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions = append(s.versions, signer)
+	return signer
+}
+
+func (s *transitStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	var data any
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/transit/keys/jwt":
+		keys := map[string]any{}
+		for index, signer := range s.versions {
+			var publicKey string
+			if edKey, ok := signer.Public().(ed25519.PublicKey); ok {
+				publicKey = base64.StdEncoding.EncodeToString(edKey)
+			} else {
+				der, _ := x509.MarshalPKIXPublicKey(signer.Public())
+				publicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			}
+			keys[strconv.Itoa(index+1)] = map[string]any{
+				"public_key":    publicKey,
+				"creation_time": time.Now().Add(time.Duration(index-len(s.versions)) * time.Minute),
+			}
+		}
+		data = map[string]any{"type": s.keyType, "latest_version": len(s.versions), "keys": keys}
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/transit/sign/jwt"):
+		var request struct {
+			Input              []byte `json:"input"`
+			KeyVersion         int    `json:"key_version"`
+			Prehashed          bool   `json:"prehashed"`
+			SignatureAlgorithm string `json:"signature_algorithm"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		signer := s.versions[request.KeyVersion-1]
+
+		var opts crypto.SignerOpts = crypto.Hash(0)
+		switch strings.TrimPrefix(r.URL.Path, "/v1/transit/sign/jwt") {
+		case "/sha2-256":
+			opts = crypto.SHA256
+		case "/sha2-512":
+			opts = crypto.SHA512
+		}
+		if request.SignatureAlgorithm == "pss" {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: opts.HashFunc()}
+		}
+
+		signature, err := signer.Sign(rand.Reader, request.Input, opts)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{err.Error()}})
+			return
+		}
+		data = map[string]any{"signature": fmt.Sprintf("vault:v%d:%s", request.KeyVersion, base64.StdEncoding.EncodeToString(signature))}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func TestVaultKeySource(t *testing.T) {
+	stub := &transitStub{keyType: "rsa-2048"}
+	old := stub.rotate(t)
+	latest := stub.rotate(t)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	source := NewVaultKeySource(server.URL, "test-token", "", "jwt")
+	ring, err := LoadKeyRing(source, "", AlgorithmPS256, time.Hour)
+	assert.NoError(t, err)
+
+	// The latest version signs, older versions only verify
+	signingKey := ring.SigningKey()
+	assert.Equal(t, mustThumbprint(t, latest.Public()), signingKey.ID)
+	oldKey, err := ring.VerificationKey(mustThumbprint(t, old.Public()))
+	assert.NoError(t, err)
+	assert.Nil(t, oldKey.PrivateKey)
+
+	digest := sha256.Sum256([]byte("signing input"))
+	signature, err := signingKey.PrivateKey.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPSS(latest.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature, nil))
+
+	sha512Digest := sha512.Sum512([]byte("signing input"))
+	signature, err = signingKey.PrivateKey.Sign(rand.Reader, sha512Digest[:], crypto.SHA512)
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(latest.Public().(*rsa.PublicKey), crypto.SHA512, sha512Digest[:], signature))
+
+	// Rotating the transit key is picked up on reload
+	state := source.State()
+	rotated := stub.rotate(t)
+	assert.NotEqual(t, state, source.State())
+	assert.NoError(t, ring.Reload())
+	assert.Equal(t, mustThumbprint(t, rotated.Public()), ring.SigningKey().ID)
+	assert.Len(t, ring.VerificationKeys(), 3)
+}
+
+func TestVaultKeySourceKeyTypes(t *testing.T) {
+	for keyType, algorithm := range map[string]string{"ecdsa-p256": AlgorithmES256, "ed25519": AlgorithmEdDSA} {
+		t.Run(keyType, func(t *testing.T) {
+			stub := &transitStub{keyType: keyType}
+			signer := stub.rotate(t)
+			server := httptest.NewServer(stub)
+			defer server.Close()
+
+			ring, err := LoadKeyRing(NewVaultKeySource(server.URL, "test-token", "transit", "jwt"), "", algorithm, time.Hour)
+			assert.NoError(t, err)
+			signingKey := ring.SigningKey()
+
+			message := []byte("signing input")
+			switch publicKey := signer.Public().(type) {
+			case *ecdsa.PublicKey:
+				digest := sha256.Sum256(message)
+				signature, err := signingKey.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+				assert.NoError(t, err)
+				assert.True(t, ecdsa.VerifyASN1(publicKey, digest[:], signature))
+			case ed25519.PublicKey:
+				signature, err := signingKey.PrivateKey.Sign(rand.Reader, message, crypto.Hash(0))
+				assert.NoError(t, err)
+				assert.True(t, ed25519.Verify(publicKey, message, signature))
+			}
+		})
+	}
+}
+
+func TestVaultKeySourceRejectsInvalidToken(t *testing.T) {
+	stub := &transitStub{keyType: "rsa-2048"}
+	stub.rotate(t)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	_, err := LoadKeyRing(NewVaultKeySource(server.URL, "wrong", "", "jwt"), "", AlgorithmRS512, time.Hour)
+	assert.ErrorContains(t, err, "permission denied")
+}
@@ -28,16 +28,24 @@ func (a *AuthController) SetupRoutes(router *gin.Engine) {
 	auth.POST("/signin/:id", a.SignInHandler)
 	auth.POST("/refresh", a.RefreshTokenHandler)
 	auth.POST("/signout", middleware.AuthMiddleware(a.DB, a.Cfg), a.SignOutHandler)
+	auth.POST("/signout-all", middleware.AuthMiddleware(a.DB, a.Cfg), middleware.RequireScopes(services.ScopeSessionsWrite), a.SignOutAllHandler)
+	auth.POST("/introspect", middleware.ClientAuthMiddleware(a.Cfg), a.IntrospectHandler)
+	auth.POST("/revoke", a.RevokeHandler)
+	auth.POST("/token", middleware.ClientAuthMiddleware(a.Cfg), a.TokenExchangeHandler)
 }
 
 // @Summary User Sign In
-// @Description Signs in a user and returns a token pair
+// @Description Signs in a user and returns a token pair, tokens requested over a connection with a client certificate are bound to it (RFC 8705)
 // @Tags Auth
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
+// @Param scope query string false "Space-delimited requested scopes, all allowed scopes if empty"
+// @Param DPoP header string false "DPoP proof to bind the issued tokens to the client key"
 // @Success 200 {object} services.TokenPair
 // @Failure 400 {object} errors.ErrorResponse "Bad Request body"
+// @Failure 401 {object} errors.ErrorResponse "Invalid DPoP proof"
+// @Failure 409 {object} errors.ErrorResponse "Maximum number of active sessions reached"
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /auth/signin/{id} [post]
 func (ac *AuthController) SignInHandler(c *gin.Context) {
@@ -47,41 +55,62 @@ func (ac *AuthController) SignInHandler(c *gin.Context) {
 		return
 	}
 
+	cnf, err := middleware.TokenConfirmation(c, ac.Cfg)
+	if err != nil {
+		logrus.WithError(err).Info("Rejected DPoP proof")
+		errors.APIError(c, errors.ErrInvalidDPoPProof)
+		return
+	}
+
 	tokenPair, err := services.SignIn(ac.DB, ac.Cfg, services.UserInfo{
 		UserID:    userID,
 		UserIP:    c.ClientIP(),
 		UserAgent: c.GetHeader("User-Agent"),
+		Scopes:    services.ParseScope(c.Query("scope")),
+		Cnf:       cnf,
 	})
-	if err != nil {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, tokenPair)
+	case models.ErrSessionLimitReached:
+		errors.APIError(c, errors.ErrSessionLimit)
+	default:
 		logrus.WithError(err).Error("Failed signin")
 		errors.APIError(c, errors.ErrInternalServer)
-		return
 	}
-
-	c.JSON(http.StatusOK, tokenPair)
 }
 
 // @Summary Refreshes the access and refresh tokens
-// @Description Refreshes the access and refresh tokens using the provided token pair
+// @Description Refreshes the access and refresh tokens using the refresh token, the access token is only required for refresh tokens issued in the legacy format, sessions bound to a client certificate require the same certificate
 // @Tags Auth
 // @Accept json
 // @Produce json
-// @Param tokenPair body services.TokenPair true "Token pair containing refresh token"
+// @Param request body services.RefreshTokenRequest true "Refresh token"
+// @Param DPoP header string false "DPoP proof, required for sessions bound to a DPoP key"
 // @Success 200 {object} services.TokenPair "New token pair"
 // @Failure 400 {object} errors.ErrorResponse "Bad request body"
+// @Failure 401 {object} errors.ErrorResponse "Invalid DPoP proof"
 // @Failure 500 {object} errors.ErrorResponse "Internal server error"
 // @Router /auth/refresh [post]
 func (ac *AuthController) RefreshTokenHandler(c *gin.Context) {
-	var tokenPair services.TokenPair
-	if err := c.ShouldBindJSON(&tokenPair); err != nil {
+	var request services.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		errors.APIError(c, errors.ErrBadRequestBody)
 		return
 	}
 
-	userIP := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
+	cnf, err := middleware.TokenConfirmation(c, ac.Cfg)
+	if err != nil {
+		logrus.WithError(err).Info("Rejected DPoP proof")
+		errors.APIError(c, errors.ErrInvalidDPoPProof)
+		return
+	}
 
-	newTokenPair, err := services.RefreshToken(ac.DB, ac.Cfg, &tokenPair, userIP, userAgent)
+	newTokenPair, err := services.RefreshToken(ac.DB, ac.Cfg, &request, services.UserInfo{
+		UserIP:    c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Cnf:       cnf,
+	})
 	if err != nil {
 		logrus.WithError(err).Error("Failed to refresh token")
 		errors.APIError(c, errors.ErrInternalServer)
@@ -117,3 +146,147 @@ func (ac *AuthController) SignOutHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.SignOutResponse{Message: "Sign out success"})
 }
+
+// @Summary Signs out all sessions of the user
+// @Description Revokes all sessions of the user and their tokens, the session of the calling token is kept if keep_current is set. Requires the sessions:write scope
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Param keep_current query bool false "Keep the session of the calling token"
+// @Success 200 {object} models.SignOutAllResponse
+// @Failure 400 {object} errors.ErrorResponse "Bad Request body"
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse "Insufficient scope"
+// @Failure 500 {object} errors.ErrorResponse "Internal server error"
+// @Router /auth/signout-all [post]
+func (ac *AuthController) SignOutAllHandler(c *gin.Context) {
+	var request struct {
+		KeepCurrent bool `form:"keep_current"`
+	}
+	if err := c.ShouldBindQuery(&request); err != nil {
+		errors.APIError(c, errors.ErrBadRequestBody)
+		return
+	}
+
+	revoked, err := services.SignOutAll(ac.DB, ac.Cfg, c.GetString("userID"), c.GetString("sessionID"), request.KeepCurrent, c.ClientIP())
+	if err != nil {
+		logrus.WithError(err).Error("Failed signout all sessions")
+		errors.APIError(c, errors.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SignOutAllResponse{Message: "Sign out success", RevokedSessions: revoked})
+}
+
+// @Summary Token introspection
+// @Description Reports whether an access or refresh token is active and returns its claims (RFC 7662)
+// @Tags Auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Security BasicAuth
+// @Param token formData string true "Token to introspect"
+// @Param token_type_hint formData string false "Hint about the type of the token"
+// @Param access_token formData string false "Access token issued together with a legacy refresh token, required to introspect it"
+// @Success 200 {object} services.IntrospectionResponse
+// @Failure 400 {object} errors.ErrorResponse "Bad Request body"
+// @Failure 401 {object} errors.ErrorResponse "Invalid client credentials"
+// @Router /auth/introspect [post]
+func (ac *AuthController) IntrospectHandler(c *gin.Context) {
+	var request models.TokenRequest
+	if err := c.ShouldBind(&request); err != nil {
+		errors.APIError(c, errors.ErrBadRequestBody)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.IntrospectToken(ac.DB, ac.Cfg, request.Token, request.AccessToken))
+}
+
+// @Summary Token revocation
+// @Description Revokes the session of an access or refresh token, expired access tokens are accepted (RFC 7009)
+// @Tags Auth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "Hint about the type of the token"
+// @Param access_token formData string false "Access token issued together with a legacy refresh token, required to revoke it"
+// @Success 200 "Token revoked or unknown"
+// @Failure 400 {object} errors.ErrorResponse "Bad Request body"
+// @Failure 500 {object} errors.ErrorResponse "Internal server error"
+// @Router /auth/revoke [post]
+func (ac *AuthController) RevokeHandler(c *gin.Context) {
+	var request models.TokenRequest
+	if err := c.ShouldBind(&request); err != nil {
+		errors.APIError(c, errors.ErrBadRequestBody)
+		return
+	}
+
+	err := services.RevokeToken(ac.DB, ac.Cfg, request.Token, request.AccessToken)
+	if err != nil {
+		logrus.WithError(err).Error("Failed revoke token")
+		errors.APIError(c, errors.ErrInternalServer)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// @Summary Token exchange
+// @Description Exchanges an access token for a down-scoped, audience-restricted token acting on behalf of its subject (RFC 8693). The actor is the subject of the actor token or the client
+// @Tags Auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Security BasicAuth
+// @Param grant_type formData string true "urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param subject_token formData string true "Access token of the user"
+// @Param subject_token_type formData string true "urn:ietf:params:oauth:token-type:access_token"
+// @Param actor_token formData string false "Access token of the acting party, needs the token:exchange scope"
+// @Param actor_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param scope formData string false "Space-delimited requested scopes, the scopes of the subject token if empty"
+// @Param audience formData []string false "Requested audiences, the audiences of the subject token if empty"
+// @Param DPoP header string false "DPoP proof, required for DPoP bound subject tokens"
+// @Success 200 {object} services.TokenExchangeResponse
+// @Failure 400 {object} errors.ErrorResponse "Invalid request"
+// @Failure 401 {object} errors.ErrorResponse "Invalid client credentials"
+// @Failure 403 {object} errors.ErrorResponse "Actor token lacks the token:exchange scope"
+// @Failure 500 {object} errors.ErrorResponse "Internal server error"
+// @Router /auth/token [post]
+func (ac *AuthController) TokenExchangeHandler(c *gin.Context) {
+	var request services.TokenExchangeRequest
+	if err := c.ShouldBind(&request); err != nil {
+		errors.APIError(c, errors.ErrBadRequestBody)
+		return
+	}
+	if request.GrantType != services.GrantTypeTokenExchange {
+		errors.APIError(c, errors.ErrUnsupportedGrant)
+		return
+	}
+
+	cnf, err := middleware.TokenConfirmation(c, ac.Cfg)
+	if err != nil {
+		logrus.WithError(err).Info("Rejected DPoP proof")
+		errors.APIError(c, errors.ErrInvalidDPoPProof)
+		return
+	}
+
+	response, err := services.ExchangeToken(ac.DB, ac.Cfg, &request, c.GetString("clientID"), services.UserInfo{
+		UserIP:    c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Cnf:       cnf,
+	})
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, response)
+	case services.ErrUnsupportedTokenType:
+		errors.APIError(c, errors.ErrUnsupportedToken)
+	case services.ErrInvalidGrant:
+		errors.APIError(c, errors.ErrInvalidGrant)
+	case services.ErrInvalidActor:
+		errors.APIError(c, errors.ErrUnauthorizedActor)
+	case services.ErrInvalidScope:
+		errors.APIError(c, errors.ErrInvalidScope)
+	case services.ErrInvalidTarget:
+		errors.APIError(c, errors.ErrInvalidTarget)
+	default:
+		logrus.WithError(err).Error("Failed token exchange")
+		errors.APIError(c, errors.ErrInternalServer)
+	}
+}
@@ -16,6 +16,7 @@ func SetupRoutes(db *gorm.DB, cfg *config.Config, router *gin.Engine) {
 	var controllersList []Controller
 	controllersList = append(controllersList, NewAuthController(db, cfg))
 	controllersList = append(controllersList, NewUserController(db, cfg))
+	controllersList = append(controllersList, NewWellKnownController(cfg))
 
 	for _, controller := range controllersList {
 		controller.SetupRoutes(router)
@@ -6,6 +6,7 @@ import (
 	"simpleAuth/errors"
 	"simpleAuth/middleware"
 	"simpleAuth/models"
+	"simpleAuth/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -25,6 +26,8 @@ func (u *UserController) SetupRoutes(router *gin.Engine) {
 	user := router.Group("/users")
 
 	user.GET("/me", middleware.AuthMiddleware(u.DB, u.Cfg), u.UserDetailHandler)
+	user.GET("/me/sessions", middleware.AuthMiddleware(u.DB, u.Cfg), middleware.RequireScopes(services.ScopeSessionsRead), u.SessionsHandler)
+	user.DELETE("/me/sessions/:id", middleware.AuthMiddleware(u.DB, u.Cfg), middleware.RequireScopes(services.ScopeSessionsWrite), u.RevokeSessionHandler)
 }
 
 // @Summary Get current user info
@@ -46,3 +49,58 @@ func (u *UserController) UserDetailHandler(c *gin.Context) {
 	logrus.Error("Failed get user detail, userID is empty")
 	errors.APIError(c, errors.ErrInternalServer)
 }
+
+// @Summary List sessions of the current user
+// @Description Lists the active sessions of the current user, the most recently used first, the session of the token making the request is marked as current. Requires the sessions:read scope
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Sessions per page, 20 by default, at most 100"
+// @Success 200 {object} services.SessionList
+// @Failure 400 {object} errors.ErrorResponse "Bad Request body"
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse "Insufficient scope"
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /users/me/sessions [get]
+func (u *UserController) SessionsHandler(c *gin.Context) {
+	var request services.SessionListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		errors.APIError(c, errors.ErrBadRequestBody)
+		return
+	}
+
+	sessions, err := services.ListSessions(u.DB, u.Cfg, c.GetString("userID"), c.GetString("sessionID"), &request)
+	if err != nil {
+		logrus.WithError(err).Error("Failed list sessions")
+		errors.APIError(c, errors.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary Revoke a session of the current user
+// @Description Signs out a session of the current user, e.g. on an unfamiliar device, its tokens are revoked at once. Requires the sessions:write scope
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.SignOutResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse "Insufficient scope"
+// @Failure 404 {object} errors.ErrorResponse "Session not found"
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /users/me/sessions/{id} [delete]
+func (u *UserController) RevokeSessionHandler(c *gin.Context) {
+	err := services.RevokeUserSession(u.DB, u.Cfg, c.GetString("userID"), c.Param("id"), c.ClientIP())
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, models.SignOutResponse{Message: "Session revoked"})
+	case services.ErrSessionNotFound:
+		errors.APIError(c, errors.ErrSessionNotFound)
+	default:
+		logrus.WithError(err).Error("Failed revoke session")
+		errors.APIError(c, errors.ErrInternalServer)
+	}
+}
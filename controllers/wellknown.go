@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"net/http"
+	"simpleAuth/config"
+	"simpleAuth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WellKnownController struct {
+	Cfg *config.Config
+}
+
+func NewWellKnownController(cfg *config.Config) *WellKnownController {
+	return &WellKnownController{Cfg: cfg}
+}
+
+func (w *WellKnownController) SetupRoutes(router *gin.Engine) {
+	wellKnown := router.Group("/.well-known")
+
+	wellKnown.GET("/jwks.json", w.JWKSHandler)
+}
+
+// @Summary JSON Web Key Set
+// @Description Returns the public keys used to verify access tokens
+// @Tags Well-Known
+// @Produce json
+// @Success 200 {object} services.JWKS
+// @Router /.well-known/jwks.json [get]
+func (w *WellKnownController) JWKSHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, services.GetJWKS(w.Cfg))
+}
@@ -15,9 +15,90 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Returns the public keys used to verify access tokens",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Well-Known"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.JWKS"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/introspect": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Reports whether an access or refresh token is active and returns its claims (RFC 7662)",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Token introspection",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token to introspect",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hint about the type of the token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token issued together with a legacy refresh token, required to introspect it",
+                        "name": "access_token",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.IntrospectionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request body",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid client credentials",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/auth/refresh": {
             "post": {
-                "description": "Refreshes the access and refresh tokens using the provided token pair",
+                "description": "Refreshes the access and refresh tokens using the refresh token, the access token is only required for refresh tokens issued in the legacy format, sessions bound to a client certificate require the same certificate",
                 "consumes": [
                     "application/json"
                 ],
@@ -30,13 +111,19 @@ const docTemplate = `{
                 "summary": "Refreshes the access and refresh tokens",
                 "parameters": [
                     {
-                        "description": "Token pair containing refresh token",
-                        "name": "tokenPair",
+                        "description": "Refresh token",
+                        "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/services.TokenPair"
+                            "$ref": "#/definitions/services.RefreshTokenRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, required for sessions bound to a DPoP key",
+                        "name": "DPoP",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -52,6 +139,62 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Invalid DPoP proof",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/revoke": {
+            "post": {
+                "description": "Revokes the session of an access or refresh token, expired access tokens are accepted (RFC 7009)",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Token revocation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token to revoke",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hint about the type of the token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token issued together with a legacy refresh token, required to revoke it",
+                        "name": "access_token",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Token revoked or unknown"
+                    },
+                    "400": {
+                        "description": "Bad Request body",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -63,7 +206,7 @@ const docTemplate = `{
         },
         "/auth/signin/{id}": {
             "post": {
-                "description": "Signs in a user and returns a token pair",
+                "description": "Signs in a user and returns a token pair, tokens requested over a connection with a client certificate are bound to it (RFC 8705)",
                 "consumes": [
                     "application/json"
                 ],
@@ -81,6 +224,18 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-delimited requested scopes, all allowed scopes if empty",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof to bind the issued tokens to the client key",
+                        "name": "DPoP",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -96,6 +251,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Invalid DPoP proof",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Maximum number of active sessions reached",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -142,6 +309,172 @@ const docTemplate = `{
                 }
             }
         },
+        "/auth/signout-all": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revokes all sessions of the user and their tokens, the session of the calling token is kept if keep_current is set. Requires the sessions:write scope",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Signs out all sessions of the user",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Keep the session of the calling token",
+                        "name": "keep_current",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SignOutAllResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request body",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/token": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Exchanges an access token for a down-scoped, audience-restricted token acting on behalf of its subject (RFC 8693). The actor is the subject of the actor token or the client",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Token exchange",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:grant-type:token-exchange",
+                        "name": "grant_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token of the user",
+                        "name": "subject_token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token",
+                        "name": "subject_token_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token of the acting party, needs the token:exchange scope",
+                        "name": "actor_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token",
+                        "name": "actor_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-delimited requested scopes, the scopes of the subject token if empty",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Requested audiences, the audiences of the subject token if empty",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, required for DPoP bound subject tokens",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.TokenExchangeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid client credentials",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Actor token lacks the token:exchange scope",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/users/me": {
             "get": {
                 "security": [
@@ -181,6 +514,127 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/users/me/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the active sessions of the current user, the most recently used first, the session of the token making the request is marked as current. Requires the sessions:read scope",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "List sessions of the current user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Sessions per page, 20 by default, at most 100",
+                        "name": "page_size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.SessionList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request body",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/sessions/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Signs out a session of the current user, e.g. on an unfamiliar device, its tokens are revoked at once. Requires the sessions:write scope",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Revoke a session of the current user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SignOutResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ErrorResponse"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -195,6 +649,17 @@ const docTemplate = `{
                 }
             }
         },
+        "models.SignOutAllResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "revoked_sessions": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.SignOutResponse": {
             "type": "object",
             "properties": {
@@ -211,6 +676,249 @@ const docTemplate = `{
                 }
             }
         },
+        "services.Actor": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "description": "Previous actor",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/services.Actor"
+                        }
+                    ]
+                },
+                "sub": {
+                    "description": "User or client ID of the actor",
+                    "type": "string"
+                }
+            }
+        },
+        "services.Confirmation": {
+            "type": "object",
+            "properties": {
+                "jkt": {
+                    "description": "SHA-256 JWK thumbprint of the DPoP key (RFC 9449)",
+                    "type": "string"
+                },
+                "x5t#S256": {
+                    "description": "SHA-256 thumbprint of the client certificate (RFC 8705)",
+                    "type": "string"
+                }
+            }
+        },
+        "services.IntrospectionResponse": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "description": "Party acting on behalf of the subject",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/services.Actor"
+                        }
+                    ]
+                },
+                "active": {
+                    "description": "Whether the token is currently active",
+                    "type": "boolean"
+                },
+                "aud": {
+                    "description": "Token audiences",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "cnf": {
+                    "description": "Key the token is bound to",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/services.Confirmation"
+                        }
+                    ]
+                },
+                "exp": {
+                    "description": "Expiration time",
+                    "type": "integer"
+                },
+                "iat": {
+                    "description": "Issue time",
+                    "type": "integer"
+                },
+                "iss": {
+                    "description": "Token issuer",
+                    "type": "string"
+                },
+                "jti": {
+                    "description": "Token ID",
+                    "type": "string"
+                },
+                "nbf": {
+                    "description": "Not before time",
+                    "type": "integer"
+                },
+                "roles": {
+                    "description": "User roles",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "scope": {
+                    "description": "Space-delimited granted scopes",
+                    "type": "string"
+                },
+                "sid": {
+                    "description": "Session ID",
+                    "type": "string"
+                },
+                "sub": {
+                    "description": "User ID",
+                    "type": "string"
+                },
+                "token_type": {
+                    "description": "Type of the token",
+                    "type": "string"
+                }
+            }
+        },
+        "services.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "description": "Signing algorithm",
+                    "type": "string"
+                },
+                "crv": {
+                    "description": "Curve of EC and OKP keys",
+                    "type": "string"
+                },
+                "e": {
+                    "description": "RSA public exponent",
+                    "type": "string"
+                },
+                "kid": {
+                    "description": "Key ID",
+                    "type": "string"
+                },
+                "kty": {
+                    "description": "Key type",
+                    "type": "string"
+                },
+                "n": {
+                    "description": "RSA modulus",
+                    "type": "string"
+                },
+                "use": {
+                    "description": "Public key use",
+                    "type": "string"
+                },
+                "x": {
+                    "description": "X coordinate of EC keys, public key of OKP keys",
+                    "type": "string"
+                },
+                "y": {
+                    "description": "Y coordinate of EC keys",
+                    "type": "string"
+                }
+            }
+        },
+        "services.JWKS": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/services.JWK"
+                    }
+                }
+            }
+        },
+        "services.RefreshTokenRequest": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "services.SessionInfo": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "Sign-in time",
+                    "type": "string"
+                },
+                "current": {
+                    "description": "Session of the access token making the request",
+                    "type": "boolean"
+                },
+                "expire_at": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "last_active_at": {
+                    "description": "Time of the last sign-in or refresh",
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "services.SessionList": {
+            "type": "object",
+            "properties": {
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/services.SessionInfo"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "services.TokenExchangeResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "issued_token_type": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
         "services.TokenPair": {
             "type": "object",
             "required": [
@@ -223,11 +931,18 @@ const docTemplate = `{
                 },
                 "refresh_token": {
                     "type": "string"
+                },
+                "token_type": {
+                    "description": "\"DPoP\" for sender-constrained tokens, \"Bearer\" otherwise",
+                    "type": "string"
                 }
             }
         }
     },
     "securityDefinitions": {
+        "BasicAuth": {
+            "type": "basic"
+        },
         "BearerAuth": {
             "description": "Enter the token with the ` + "`" + `Bearer: ` + "`" + ` prefix, e.g. \"Bearer abcde12345\".",
             "type": "apiKey",
@@ -244,7 +959,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "",
 	Schemes:          []string{},
 	Title:            "",
-	Description:      "",
+	Description:      "OAuth client credentials",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
@@ -20,8 +20,20 @@ func APIError(c *gin.Context, err *ErrorResponse) {
 
 var (
 	ErrBadRequestBody      = NewErr(400, "Bad Request body")
+	ErrUnsupportedGrant    = NewErr(400, "Unsupported grant type")
+	ErrUnsupportedToken    = NewErr(400, "Unsupported token type")
+	ErrInvalidGrant        = NewErr(400, "Invalid subject or actor token")
+	ErrInvalidScope        = NewErr(400, "Requested scope exceeds the granted scope")
+	ErrInvalidTarget       = NewErr(400, "Requested audience is not served")
 	ErrHeaderIsMissing     = NewErr(401, "Authorization header is missing")
 	ErrInvalidHeaderFormat = NewErr(401, "Invalid authorization header format")
 	ErrIncorrectToken      = NewErr(401, "Incorrect Token")
+	ErrInvalidDPoPProof    = NewErr(401, "Invalid DPoP proof")
+	ErrInvalidCertificate  = NewErr(401, "Client certificate does not match the token")
+	ErrInvalidClient       = NewErr(401, "Invalid client credentials")
+	ErrInsufficientScope   = NewErr(403, "Insufficient scope")
+	ErrUnauthorizedActor   = NewErr(403, "Actor is not allowed to act on behalf of users")
+	ErrSessionNotFound     = NewErr(404, "Session not found")
+	ErrSessionLimit        = NewErr(409, "Maximum number of active sessions reached")
 	ErrInternalServer      = NewErr(500, "An unexpected error occurred while processing the request")
 )
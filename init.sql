@@ -5,11 +5,52 @@ CREATE TABLE IF NOT EXISTS Sessions (
     ip VARCHAR(45),
     user_agent VARCHAR(512),
     refresh_token TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    roles VARCHAR(255) NOT NULL DEFAULT '',
+    access_token_ids TEXT NOT NULL DEFAULT '',
+    dpop_jkt VARCHAR(64) NOT NULL DEFAULT '',
+    cert_thumbprint VARCHAR(64) NOT NULL DEFAULT '',
+    access_token_hash VARCHAR(64) NOT NULL DEFAULT '',
+    access_token_expire_at TIMESTAMP NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NULL DEFAULT now(),
     expire_at TIMESTAMP NOT NULL
 );
 
+CREATE INDEX IF NOT EXISTS idx_sessions_access_token_hash ON sessions(access_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id_updated_at ON sessions(user_id, updated_at);
+
+-- Использованные refresh токены сессии для обнаружения повторного использования
+CREATE TABLE IF NOT EXISTS used_refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id VARCHAR(36) NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+    refresh_token TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_used_refresh_tokens_session_id ON used_refresh_tokens(session_id);
+CREATE INDEX IF NOT EXISTS idx_used_refresh_tokens_session_id_refresh_token ON used_refresh_tokens(session_id, refresh_token);
+
+-- Отозванные до истечения срока действия access токены
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti VARCHAR(36) PRIMARY KEY,
+    expire_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expire_at ON revoked_access_tokens(expire_at);
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_created_at ON revoked_access_tokens(created_at);
+
+-- Access токены, выданные обменом токенов, отзываются вместе с сессией
+CREATE TABLE IF NOT EXISTS exchanged_access_tokens (
+    jti VARCHAR(36) PRIMARY KEY,
+    session_id VARCHAR(36) NOT NULL,
+    expire_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchanged_access_tokens_session_id ON exchanged_access_tokens(session_id);
+
 CREATE OR REPLACE FUNCTION update_column()
 RETURNS TRIGGER AS $$
 BEGIN
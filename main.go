@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"simpleAuth/config"
 	"simpleAuth/controllers"
 	"simpleAuth/models"
+	"simpleAuth/services"
+	"time"
 
 	_ "simpleAuth/docs"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -17,19 +21,46 @@ import (
 // @Description Enter the token with the `Bearer: ` prefix, e.g. "Bearer abcde12345".
 // @in header
 // @name Authorization
+
+// @securityDefinitions.basic BasicAuth
+// @Description OAuth client credentials
 func main() {
 	ctx := context.Background()
-	cfg := config.LoadConfig(ctx, ".env", "certs/jwt-private.pem", "certs/jwt-public.pem")
+	cfg := config.LoadConfig(ctx, ".env", "certs")
+	if _, err := services.NewRefreshTokenHasher(cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid refresh token hash configuration")
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 
 	db := models.NewDBConnection(cfg)
 
+	services.StartTokenDenylistSync(db, time.Duration(cfg.DenylistSyncSeconds)*time.Second)
+	cfg.Keys.StartReload(time.Duration(cfg.KeyReloadSeconds) * time.Second)
+
 	router := gin.Default()
 
 	controllers.SetupRoutes(db, cfg, router)
 
 	router.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	router.Run(":3000")
+	if cfg.TLSCertFile == "" {
+		router.Run(":3000")
+		return
+	}
+
+	tlsConfig, err := config.LoadTLSConfig(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error load TLS configuration")
+	}
+
+	server := &http.Server{
+		Addr:      ":3000",
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+
+	if err := server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+		logrus.WithError(err).Fatal("Server stopped")
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"simpleAuth/config"
 	"simpleAuth/errors"
 	"simpleAuth/services"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +22,7 @@ func AuthMiddleware(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
 		}
 
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "DPoP") {
 			errors.APIError(c, errors.ErrInvalidHeaderFormat)
 			c.Abort()
 			return
@@ -29,7 +30,7 @@ func AuthMiddleware(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		payload, err := services.ValidateToken(tokenString, cfg.RSAPublicKey)
+		payload, err := services.AuthenticateAccessToken(db, cfg, tokenString)
 
 		if err != nil {
 			errors.APIError(c, errors.ErrIncorrectToken)
@@ -37,15 +38,68 @@ func AuthMiddleware(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		_, err = services.CheckSessionExists(db, payload.SID)
-		if err != nil {
-			errors.APIError(c, errors.ErrIncorrectToken)
+		// DPoP bound tokens must be presented with the DPoP scheme and a proof of the bound key
+		if payload.Cnf != nil && payload.Cnf.JKT != "" {
+			if parts[0] != "DPoP" {
+				errors.APIError(c, errors.ErrInvalidDPoPProof)
+				c.Abort()
+				return
+			}
+
+			jkt, err := services.VerifyDPoPProof(cfg, c.GetHeader("DPoP"), c.Request.Method, RequestURL(c, cfg), tokenString)
+			if err != nil || jkt != payload.Cnf.JKT {
+				errors.APIError(c, errors.ErrInvalidDPoPProof)
+				c.Abort()
+				return
+			}
+		} else if parts[0] != "Bearer" {
+			errors.APIError(c, errors.ErrInvalidHeaderFormat)
+			c.Abort()
+			return
+		}
+
+		// Certificate-bound tokens must be presented over a connection with the same client certificate
+		if payload.Cnf != nil && payload.Cnf.X5TS256 != "" && ClientCertificateThumbprint(c) != payload.Cnf.X5TS256 {
+			errors.APIError(c, errors.ErrInvalidCertificate)
 			c.Abort()
 			return
 		}
 
+		if cfg.CheckSessionOnRequest {
+			_, err = services.CheckSessionExists(db, payload.SID)
+			if err != nil {
+				errors.APIError(c, errors.ErrIncorrectToken)
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("sessionID", payload.SID)
 		c.Set("userID", payload.Subject)
+		c.Set("scopes", services.ParseScope(payload.Scope))
+		c.Set("roles", payload.Roles)
+		if payload.Act != nil {
+			// Subjects of the parties acting on behalf of the user, the current actor first
+			c.Set("actors", payload.Act.Chain())
+		}
+
+		c.Next()
+	}
+}
+
+// Middleware function for Gin that requires all of the given scopes in the access token.
+// Must be used after AuthMiddleware.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grantedScopes := c.GetStringSlice("scopes")
+
+		for _, scope := range scopes {
+			if !slices.Contains(grantedScopes, scope) {
+				errors.APIError(c, errors.ErrInsufficientScope)
+				c.Abort()
+				return
+			}
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupScopesRouter(grantedScopes []string, requiredScopes ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		c.Set("scopes", grantedScopes)
+	}, RequireScopes(requiredScopes...), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return router
+}
+
+func TestRequireScopes(t *testing.T) {
+	router := setupScopesRouter([]string{"profile", "sessions:read"}, "sessions:read")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequireScopesMissing(t *testing.T) {
+	router := setupScopesRouter([]string{"profile"}, "profile", "admin")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"code":403,"message":"Insufficient scope"}`, w.Body.String())
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"simpleAuth/config"
+	"simpleAuth/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware function for Gin that authenticates OAuth clients with HTTP Basic credentials.
+func ClientAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, clientSecret, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="simpleAuth"`)
+			errors.APIError(c, errors.ErrInvalidClient)
+			c.Abort()
+			return
+		}
+
+		expectedSecret, ok := cfg.OAuthClients[clientID]
+		if !ok || subtle.ConstantTimeCompare([]byte(expectedSecret), []byte(clientSecret)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="simpleAuth"`)
+			errors.APIError(c, errors.ErrInvalidClient)
+			c.Abort()
+			return
+		}
+
+		c.Set("clientID", clientID)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"simpleAuth/config"
+	"simpleAuth/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Returns the absolute URL of the request without query, as covered by the DPoP "htu" claim.
+// Behind a TLS terminating proxy the external URL is taken from the configured public URL,
+// forwarded headers are never trusted since clients can set them to match a proof made for another URL.
+func RequestURL(c *gin.Context, cfg *config.Config) string {
+	if cfg.PublicURL != "" {
+		return strings.TrimSuffix(cfg.PublicURL, "/") + c.Request.URL.Path
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.Path
+}
+
+// Verifies the DPoP proof sent to a token endpoint.
+// Returns nil without error when the client did not send a proof and asks for bearer tokens.
+func DPoPConfirmation(c *gin.Context, cfg *config.Config) (*services.Confirmation, error) {
+	proof := c.GetHeader("DPoP")
+	if proof == "" {
+		return nil, nil
+	}
+
+	jkt, err := services.VerifyDPoPProof(cfg, proof, c.Request.Method, RequestURL(c, cfg), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.Confirmation{JKT: jkt}, nil
+}
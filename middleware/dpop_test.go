@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	request := httptest.NewRequest(http.MethodPost, "http://auth.internal/auth/refresh?x=1", nil)
+	request.Header.Set("X-Forwarded-Proto", "https")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = request
+
+	// Forwarded headers are set by the client and ignored
+	assert.Equal(t, "http://auth.internal/auth/refresh", RequestURL(c, &config.Config{}))
+
+	cfg := &config.Config{PublicURL: "https://auth.example.com/"}
+	assert.Equal(t, "https://auth.example.com/auth/refresh", RequestURL(c, cfg))
+}
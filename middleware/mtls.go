@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"simpleAuth/config"
+	"simpleAuth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Returns the "x5t#S256" thumbprint of the verified client certificate of the connection,
+// or an empty string when the client did not present one.
+func ClientCertificateThumbprint(c *gin.Context) string {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return services.CertificateThumbprint(c.Request.TLS.PeerCertificates[0].Raw)
+}
+
+// Collects the keys the client proved possession of at a token endpoint:
+// the DPoP key and the mutual-TLS client certificate.
+// Returns nil without error when the client asks for unbound bearer tokens.
+func TokenConfirmation(c *gin.Context, cfg *config.Config) (*services.Confirmation, error) {
+	cnf, err := DPoPConfirmation(c, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbprint := ClientCertificateThumbprint(c); thumbprint != "" {
+		if cnf == nil {
+			cnf = &services.Confirmation{}
+		}
+		cnf.X5TS256 = thumbprint
+	}
+
+	return cnf, nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Access token issued by token exchange for a session, denylisted when the session is revoked.
+// Kept apart from the session row, so exchanges neither overwrite concurrent session updates
+// nor count as session activity.
+type ExchangedAccessToken struct {
+	JTI       string    `json:"jti"        gorm:"primaryKey; type:varchar(36)"`
+	SessionID string    `json:"session_id" gorm:"type:varchar(36); not null; index"`
+	ExpireAt  time.Time `json:"expire_at"  gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Creates the exchanged_access_tokens table in databases created before it was added
+var exchangedAccessTokenMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS exchanged_access_tokens (
+		jti VARCHAR(36) PRIMARY KEY,
+		session_id VARCHAR(36) NOT NULL,
+		expire_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_exchanged_access_tokens_session_id ON exchanged_access_tokens(session_id)`,
+}
+
+// Adds an access token issued by token exchange to the exchanged_access_tokens table.
+func CreateExchangedAccessToken(db *gorm.DB, token *ExchangedAccessToken) error {
+	return db.Create(token).Error
+}
+
+// Retrieves the unexpired access tokens issued by token exchange for the sessions.
+func GetExchangedAccessTokens(db *gorm.DB, sessionIDs []string) (tokens []ExchangedAccessToken, err error) {
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	err = db.Where("session_id IN ? AND expire_at > ?", sessionIDs, time.Now()).Find(&tokens).Error
+	return tokens, err
+}
+
+// Removes the access tokens issued by token exchange for the sessions.
+func DeleteExchangedAccessTokens(db *gorm.DB, sessionIDs []string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	return db.Where("session_id IN ?", sessionIDs).Delete(&ExchangedAccessToken{}).Error
+}
+
+// Removes the expired access tokens issued by token exchange for the session.
+func PruneExchangedAccessTokens(db *gorm.DB, sessionID string) error {
+	return db.Where("session_id = ? AND expire_at <= ?", sessionID, time.Now()).Delete(&ExchangedAccessToken{}).Error
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"simpleAuth/config"
 	"simpleAuth/logger"
+	"slices"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -44,16 +45,13 @@ func NewDBConnection(cfg *config.Config) *gorm.DB {
 		logrus.WithError(result.Error).Fatal("Failed retrieving table list")
 	}
 
-	found := false
-	for _, table := range tables {
-		if table == "sessions" {
-			found = true
-			break
-		}
+	if !slices.Contains(tables, "sessions") {
+		logrus.Fatal("Session table in db not found")
 	}
 
-	if !found {
-		logrus.Fatal("Session table in db not found")
+	// Databases created before the current init.sql lack the newer columns and tables
+	if err := Migrate(DB); err != nil {
+		logrus.WithError(err).Fatal("Failed migrate database schema")
 	}
 
 	return DB
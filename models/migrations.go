@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Schema changes applied on startup, so databases created by an older init.sql are upgraded.
+// Every statement is idempotent and brings an existing database to the schema init.sql creates.
+// Each model declares the statements upgrading its table next to the columns they add.
+func migrations() []string {
+	return slices.Concat(sessionMigrations, usedRefreshTokenMigrations, revokedAccessTokenMigrations, exchangedAccessTokenMigrations)
+}
+
+// Applies the schema migrations to a PostgreSQL database in one transaction.
+func Migrate(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, migration := range migrations() {
+			if err := tx.Exec(migration).Error; err != nil {
+				return fmt.Errorf("error applying migration %q: %v", migration, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Access token revoked before its expiration, identified by the "jti" claim.
+type RevokedAccessToken struct {
+	JTI       string    `json:"jti"        gorm:"primaryKey; type:varchar(36)"`
+	ExpireAt  time.Time `json:"expire_at"  gorm:"not null; index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime; index"`
+}
+
+// Creates the revoked_access_tokens table in databases created before the denylist
+var revokedAccessTokenMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+		jti VARCHAR(36) PRIMARY KEY,
+		expire_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expire_at ON revoked_access_tokens(expire_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_created_at ON revoked_access_tokens(created_at)`,
+}
+
+// Adds access tokens to the revoked_access_tokens table, already revoked tokens are ignored.
+func CreateRevokedAccessTokens(db *gorm.DB, tokens []RevokedAccessToken) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tokens).Error
+}
+
+// Retrieves the unexpired revoked access tokens added since the given time.
+func GetRevokedAccessTokens(db *gorm.DB, since time.Time) (tokens []RevokedAccessToken, err error) {
+	err = db.Where("created_at >= ? AND expire_at > ?", since, time.Now()).Find(&tokens).Error
+	return tokens, err
+}
+
+// Removes revoked access tokens that have expired and no longer need to be denied.
+func DeleteExpiredRevokedAccessTokens(db *gorm.DB) error {
+	return db.Where("expire_at <= ?", time.Now()).Delete(&RevokedAccessToken{}).Error
+}
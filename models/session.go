@@ -1,21 +1,51 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Returned when the user has the maximum number of active sessions and new sessions are rejected.
+var ErrSessionLimitReached = errors.New("maximum number of active sessions reached")
+
 type Session struct {
-	SessionID    string    `json:"session_id"    gorm:"primaryKey; type:varchar(36)"`
-	UserID       string    `json:"user_id"       gorm:"type:varchar(36); not null"`
-	IP           string    `json:"ip"            gorm:"type:varchar(45)"`
-	UserAgent    string    `json:"user_agent"    gorm:"type:varchar(512)"`
-	RefreshToken string    `json:"refresh_token" gorm:"type:text"`
-	CreatedAt    time.Time `json:"created_at"    gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"updated_at"    gorm:"autoUpdateTime"`
-	ExpireAt     time.Time `json:"expire_at"     gorm:"not null"`
+	SessionID           string    `json:"session_id"      gorm:"primaryKey; type:varchar(36)"`
+	UserID              string    `json:"user_id"         gorm:"type:varchar(36); not null; index:idx_sessions_user_id_updated_at"`
+	IP                  string    `json:"ip"              gorm:"type:varchar(45)"`
+	UserAgent           string    `json:"user_agent"      gorm:"type:varchar(512)"`
+	RefreshToken        string    `json:"refresh_token"   gorm:"type:text"`
+	Scope               string    `json:"scope"           gorm:"type:text"`
+	Roles               string    `json:"roles"           gorm:"type:varchar(255)"`
+	AccessTokenIDs      string    `json:"-"               gorm:"type:text"`                         // Unexpired access tokens issued for the session as "jti@exp"
+	DPoPJKT             string    `json:"dpop_jkt"        gorm:"column:dpop_jkt; type:varchar(64)"` // Thumbprint of the DPoP key the session is bound to
+	CertThumbprint      string    `json:"cert_thumbprint" gorm:"type:varchar(64)"`                  // Thumbprint of the client certificate the session is bound to
+	AccessTokenHash     string    `json:"-"               gorm:"type:varchar(64); index"`           // SHA-256 hash of the current opaque access token
+	AccessTokenExpireAt time.Time `json:"-"`                                                        // Expiration time of the current opaque access token
+	CreatedAt           time.Time `json:"created_at"      gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `json:"updated_at"      gorm:"autoUpdateTime; index:idx_sessions_user_id_updated_at"`
+	ExpireAt            time.Time `json:"expire_at"       gorm:"not null"`
+}
+
+// Upgrades sessions tables created before the columns were added
+var sessionMigrations = []string{
+	// Granted scopes and roles
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS roles VARCHAR(255) NOT NULL DEFAULT ''`,
+	// Access tokens denylisted when the session is revoked
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS access_token_ids TEXT NOT NULL DEFAULT ''`,
+	// Key of DPoP-bound sessions
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS dpop_jkt VARCHAR(64) NOT NULL DEFAULT ''`,
+	// Client certificate of certificate-bound sessions
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS cert_thumbprint VARCHAR(64) NOT NULL DEFAULT ''`,
+	// Current opaque access token
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS access_token_hash VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS access_token_expire_at TIMESTAMP NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_access_token_hash ON sessions(access_token_hash)`,
+	// Listing the user's sessions by last use
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user_id_updated_at ON sessions(user_id, updated_at)`,
 }
 
 type UserResponse struct {
@@ -26,6 +56,18 @@ type SignOutResponse struct {
 	Message string `json:"message"`
 }
 
+type SignOutAllResponse struct {
+	Message         string `json:"message"`
+	RevokedSessions int    `json:"revoked_sessions"`
+}
+
+// Token introspection and revocation request (RFC 7662, RFC 7009)
+type TokenRequest struct {
+	Token         string `form:"token"           binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	AccessToken   string `form:"access_token"` // Access token issued together with a legacy refresh token, identifies its session
+}
+
 // Adds a new session to the sessions table.
 func CreateSession(db *gorm.DB, session *Session) (string, error) {
 	if session.SessionID == "" {
@@ -39,18 +81,119 @@ func CreateSession(db *gorm.DB, session *Session) (string, error) {
 	return session.SessionID, nil
 }
 
+// Limit of active sessions per user
+type SessionLimit struct {
+	MaxSessions int       // Maximum number of active sessions of the user, including the new one
+	Evict       bool      // Remove the least recently used sessions instead of rejecting the new one
+	Now         time.Time // Sessions expired at this time are not active
+	IdleSince   time.Time // Sessions not used since this time are not active
+}
+
+// Adds a new session unless the user would exceed the limit of active sessions.
+// At the limit, the least recently used sessions are removed and returned if limit.Evict is set,
+// otherwise ErrSessionLimitReached is returned. Sign-ins of the same user are serialized,
+// so concurrent sign-ins cannot exceed the limit.
+func CreateSessionWithinLimit(db *gorm.DB, session *Session, limit SessionLimit) (evicted []Session, err error) {
+	if session.SessionID == "" {
+		session.SessionID = uuid.New().String()
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserSessions(tx, session.UserID); err != nil {
+			return err
+		}
+
+		var active []Session
+		err := tx.Where("user_id = ? AND expire_at > ? AND updated_at > ?", session.UserID, limit.Now, limit.IdleSince).
+			Order("updated_at, session_id").Find(&active).Error
+		if err != nil {
+			return err
+		}
+
+		if excess := len(active) - limit.MaxSessions + 1; excess > 0 {
+			if !limit.Evict {
+				return ErrSessionLimitReached
+			}
+
+			evicted = active[:excess]
+			sessionIDs := make([]string, 0, len(evicted))
+			for _, session := range evicted {
+				sessionIDs = append(sessionIDs, session.SessionID)
+			}
+			if err := DeleteSessions(tx, sessionIDs); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// Serializes transactions changing the sessions of the user until the transaction ends.
+// PostgreSQL takes a transaction-level advisory lock on the user ID, SQLite allows a single writer anyway.
+func lockUserSessions(tx *gorm.DB, userID string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", userID).Error
+}
+
 // Retrieves the session's data from the sessions table by their identifier.
 func GetSession(db *gorm.DB, sessionID string) (session *Session, err error) {
 	err = db.Where("session_id = ?", sessionID).First(&session).Error
 	return session, err
 }
 
+// Retrieves the session an opaque access token was issued for by the token hash.
+func GetSessionByAccessToken(db *gorm.DB, accessTokenHash string) (session *Session, err error) {
+	err = db.Where("access_token_hash = ?", accessTokenHash).First(&session).Error
+	return session, err
+}
+
+// Retrieves a page of the user's sessions that have not expired at now and were used after idleSince,
+// the most recently used first, together with the total number of such sessions.
+func GetUserSessions(db *gorm.DB, userID string, now time.Time, idleSince time.Time, offset int, limit int) (sessions []Session, total int64, err error) {
+	activeSessions := func() *gorm.DB {
+		return db.Model(&Session{}).Where("user_id = ? AND expire_at > ? AND updated_at > ?", userID, now, idleSince)
+	}
+
+	if err = activeSessions().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = activeSessions().Order("updated_at DESC, session_id").Offset(offset).Limit(limit).Find(&sessions).Error
+	return sessions, total, err
+}
+
 // Updates the session's data in the sessions table.
 func UpdateSession(db *gorm.DB, session *Session) error {
 	return db.Model(&Session{}).Where("session_id = ?", session.SessionID).Updates(session).Error
 }
 
-// Removes a session from the sessions table by their identifier.
+// Removes a session and its superseded refresh tokens by the session identifier.
 func DeleteSession(db *gorm.DB, sessionID string) error {
-	return db.Where("session_id = ?", sessionID).Delete(&Session{}).Error
+	return DeleteSessions(db, []string{sessionID})
+}
+
+// Removes sessions and their superseded refresh tokens by the session identifiers.
+func DeleteSessions(db *gorm.DB, sessionIDs []string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id IN ?", sessionIDs).Delete(&UsedRefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("session_id IN ?", sessionIDs).Delete(&Session{}).Error
+	})
+}
+
+// Retrieves all sessions of the user, including expired and idle ones, except the one with exceptSessionID, if not empty.
+func GetAllUserSessions(db *gorm.DB, userID string, exceptSessionID string) (sessions []Session, err error) {
+	err = db.Where("user_id = ? AND session_id <> ?", userID, exceptSessionID).Find(&sessions).Error
+	return sessions, err
 }
@@ -19,7 +19,7 @@ func setupTestDB() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&Session{})
+	err = db.AutoMigrate(&Session{}, &UsedRefreshToken{}, &RevokedAccessToken{}, &ExchangedAccessToken{})
 	if err != nil {
 		return nil, err
 	}
@@ -119,3 +119,113 @@ func TestDeleteSession(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
+
+func TestGetUserSessions(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	userID := uuid.New().String()
+	now := time.Now()
+	for _, session := range []Session{
+		{SessionID: "old", UserID: userID, ExpireAt: now.Add(time.Hour), UpdatedAt: now.Add(-2 * time.Hour)},
+		{SessionID: "recent", UserID: userID, ExpireAt: now.Add(time.Hour), UpdatedAt: now.Add(-time.Minute)},
+		{SessionID: "idle", UserID: userID, ExpireAt: now.Add(time.Hour), UpdatedAt: now.Add(-5 * time.Hour)},
+		{SessionID: "expired", UserID: userID, ExpireAt: now.Add(-time.Hour), UpdatedAt: now},
+		{SessionID: "other", UserID: uuid.New().String(), ExpireAt: now.Add(time.Hour), UpdatedAt: now},
+	} {
+		assert.NoError(t, db.Create(&session).Error)
+		assert.NoError(t, db.Model(&session).UpdateColumn("updated_at", session.UpdatedAt).Error)
+	}
+
+	sessions, total, err := GetUserSessions(db, userID, now, now.Add(-3*time.Hour), 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "recent", sessions[0].SessionID)
+
+	sessions, _, err = GetUserSessions(db, userID, now, now.Add(-3*time.Hour), 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "old", sessions[0].SessionID)
+}
+
+func TestGetAllUserSessions(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	userID := uuid.New().String()
+	for _, session := range []Session{
+		{SessionID: "current", UserID: userID, ExpireAt: time.Now().Add(time.Hour)},
+		{SessionID: "phone", UserID: userID, ExpireAt: time.Now().Add(time.Hour)},
+		{SessionID: "expired", UserID: userID, ExpireAt: time.Now().Add(-time.Hour)},
+		{SessionID: "other", UserID: uuid.New().String(), ExpireAt: time.Now().Add(time.Hour)},
+	} {
+		assert.NoError(t, db.Create(&session).Error)
+	}
+
+	sessions, err := GetAllUserSessions(db, userID, "current")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	sessions, err = GetAllUserSessions(db, userID, "")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 3)
+}
+
+func TestDeleteSessions(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	userID := uuid.New().String()
+	for _, session := range []Session{
+		{SessionID: "current", UserID: userID, ExpireAt: time.Now().Add(time.Hour)},
+		{SessionID: "phone", UserID: userID, ExpireAt: time.Now().Add(time.Hour)},
+		{SessionID: "laptop", UserID: userID, ExpireAt: time.Now().Add(time.Hour)},
+	} {
+		assert.NoError(t, db.Create(&session).Error)
+	}
+	assert.NoError(t, db.Create(&UsedRefreshToken{SessionID: "phone", RefreshToken: "used"}).Error)
+
+	assert.NoError(t, DeleteSessions(db, []string{"phone", "laptop"}))
+
+	var remaining []string
+	assert.NoError(t, db.Model(&Session{}).Order("session_id").Pluck("session_id", &remaining).Error)
+	assert.Equal(t, []string{"current"}, remaining)
+
+	var usedTokens int64
+	assert.NoError(t, db.Model(&UsedRefreshToken{}).Count(&usedTokens).Error)
+	assert.Zero(t, usedTokens)
+}
+
+func TestCreateSessionWithinLimit(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	userID := uuid.New().String()
+	now := time.Now()
+	for _, session := range []Session{
+		{SessionID: "oldest", UserID: userID, ExpireAt: now.Add(time.Hour), UpdatedAt: now.Add(-2 * time.Hour)},
+		{SessionID: "recent", UserID: userID, ExpireAt: now.Add(time.Hour), UpdatedAt: now.Add(-time.Minute)},
+		{SessionID: "expired", UserID: userID, ExpireAt: now.Add(-time.Hour), UpdatedAt: now},
+	} {
+		assert.NoError(t, db.Create(&session).Error)
+		assert.NoError(t, db.Model(&session).UpdateColumn("updated_at", session.UpdatedAt).Error)
+	}
+
+	limit := SessionLimit{MaxSessions: 2, Now: now}
+	_, err = CreateSessionWithinLimit(db, &Session{UserID: userID, ExpireAt: now.Add(time.Hour)}, limit)
+	assert.Equal(t, ErrSessionLimitReached, err)
+
+	// Expired sessions do not count towards the limit, the least recently used session is evicted
+	limit.Evict = true
+	session := &Session{UserID: userID, ExpireAt: now.Add(time.Hour)}
+	evicted, err := CreateSessionWithinLimit(db, session, limit)
+	assert.NoError(t, err)
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "oldest", evicted[0].SessionID)
+
+	_, err = GetSession(db, session.SessionID)
+	assert.NoError(t, err)
+	_, err = GetSession(db, "oldest")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Returned when the session's refresh token was rotated by a concurrent request.
+var ErrRefreshTokenAlreadyRotated = errors.New("refresh token already rotated")
+
+// Superseded refresh token of a session, kept to detect refresh token reuse.
+// Only a SHA-256 fingerprint is stored: the secrets are 256 bits of randomness, so a reused token
+// is found with a single lookup instead of comparing slow password hashes one by one.
+type UsedRefreshToken struct {
+	ID           uint      `json:"id"            gorm:"primaryKey"`
+	SessionID    string    `json:"session_id"    gorm:"type:varchar(36); not null; index; index:idx_used_refresh_tokens_session_id_refresh_token"`
+	RefreshToken string    `json:"refresh_token" gorm:"type:text; not null; index:idx_used_refresh_tokens_session_id_refresh_token"` // Fingerprint of the superseded refresh token
+	CreatedAt    time.Time `json:"created_at"    gorm:"autoCreateTime"`
+}
+
+// Creates the used_refresh_tokens table in databases created before reuse detection
+var usedRefreshTokenMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS used_refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		session_id VARCHAR(36) NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+		refresh_token TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_used_refresh_tokens_session_id ON used_refresh_tokens(session_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_used_refresh_tokens_session_id_refresh_token ON used_refresh_tokens(session_id, refresh_token)`,
+}
+
+// Replaces the session's refresh token and keeps the fingerprint of the superseded token.
+// Fails with ErrRefreshTokenAlreadyRotated if the stored hash no longer equals previousRefreshToken.
+func RotateRefreshToken(db *gorm.DB, session *Session, previousRefreshToken string, previousFingerprint string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Session{}).
+			Where("session_id = ? AND refresh_token = ?", session.SessionID, previousRefreshToken).
+			Updates(session)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenAlreadyRotated
+		}
+
+		return tx.Create(&UsedRefreshToken{SessionID: session.SessionID, RefreshToken: previousFingerprint}).Error
+	})
+}
+
+// Reports whether a refresh token with the fingerprint was superseded in the session.
+func IsUsedRefreshToken(db *gorm.DB, sessionID string, fingerprint string) (bool, error) {
+	var count int64
+	err := db.Model(&UsedRefreshToken{}).Where("session_id = ? AND refresh_token = ?", sessionID, fingerprint).Count(&count).Error
+	return count > 0, err
+}
+
+// Retrieves the superseded refresh token fingerprints of the session.
+func GetUsedRefreshTokens(db *gorm.DB, sessionID string) (usedTokens []UsedRefreshToken, err error) {
+	err = db.Where("session_id = ?", sessionID).Order("created_at DESC").Find(&usedTokens).Error
+	return usedTokens, err
+}
+
+// Removes superseded refresh token fingerprints of the session created before the given time.
+func PruneUsedRefreshTokens(db *gorm.DB, sessionID string, before time.Time) error {
+	return db.Where("session_id = ? AND created_at < ?", sessionID, before).Delete(&UsedRefreshToken{}).Error
+}
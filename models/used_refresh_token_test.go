@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	session := &Session{
+		SessionID:    uuid.New().String(),
+		UserID:       uuid.New().String(),
+		RefreshToken: "first-refresh-token",
+		ExpireAt:     time.Now().Add(24 * time.Hour),
+	}
+
+	db.Create(session)
+
+	session.RefreshToken = "second-refresh-token"
+	err = RotateRefreshToken(db, session, "first-refresh-token", "first-fingerprint")
+	assert.NoError(t, err)
+
+	usedTokens, err := GetUsedRefreshTokens(db, session.SessionID)
+	assert.NoError(t, err)
+	assert.Len(t, usedTokens, 1)
+	assert.Equal(t, "first-fingerprint", usedTokens[0].RefreshToken)
+
+	used, err := IsUsedRefreshToken(db, session.SessionID, "first-fingerprint")
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = IsUsedRefreshToken(db, session.SessionID, "unknown-fingerprint")
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	session.RefreshToken = "third-refresh-token"
+	err = RotateRefreshToken(db, session, "first-refresh-token", "first-fingerprint")
+	assert.Equal(t, ErrRefreshTokenAlreadyRotated, err)
+
+	err = DeleteSession(db, session.SessionID)
+	assert.NoError(t, err)
+
+	usedTokens, err = GetUsedRefreshTokens(db, session.SessionID)
+	assert.NoError(t, err)
+	assert.Empty(t, usedTokens)
+}
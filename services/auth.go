@@ -1,11 +1,14 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"simpleAuth/config"
 	"simpleAuth/models"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -14,66 +17,94 @@ type UserInfo struct {
 	UserID    string
 	UserIP    string
 	UserAgent string
+	Scopes    []string      // Requested scopes, all allowed scopes are granted if empty
+	Cnf       *Confirmation // Key proven by the client, issued tokens are bound to it
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"access_token" binding:"required"`
 	RefreshToken string `json:"refresh_token" binding:"required"`
+	TokenType    string `json:"token_type,omitempty"` // "DPoP" for sender-constrained tokens, "Bearer" otherwise
+}
+
+// Refresh request, the access token is only needed for refresh tokens issued in the legacy format
+type RefreshTokenRequest struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // Authenticates a user and generates a pair of tokens (access and refresh tokens).
+// At the session limit the sign-in fails with models.ErrSessionLimitReached or evicts the least recently used session.
 func SignIn(db *gorm.DB, cfg *config.Config, userDetail UserInfo) (*TokenPair, error) {
-	refreshToken, err := GenerateRefreshToken()
+	now := time.Now()
+	sessionID := uuid.New().String()
+
+	refreshToken, err := GenerateRefreshToken(sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	hashedRefreshToken, err := HashRefreshToken(refreshToken)
+	hashedRefreshToken, err := HashRefreshToken(cfg, refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
+	roles, scopes := GrantScopes(cfg, userDetail.UserID, userDetail.Scopes)
+
 	session := models.Session{
+		SessionID:    sessionID,
 		UserID:       userDetail.UserID,
 		IP:           userDetail.UserIP,
 		UserAgent:    userDetail.UserAgent,
 		RefreshToken: hashedRefreshToken,
-		ExpireAt:     time.Now().Add(time.Duration(cfg.RefreshTokenExpireMinutes) * time.Minute),
+		Scope:        FormatScope(scopes),
+		Roles:        strings.Join(roles, " "),
+		CreatedAt:    now,
+		ExpireAt:     sessionExpireAt(cfg, now, now),
+	}
+	if userDetail.Cnf != nil {
+		session.DPoPJKT = userDetail.Cnf.JKT
+		session.CertThumbprint = userDetail.Cnf.X5TS256
 	}
 
-	sessionID, err := models.CreateSession(db, &session)
+	accessToken, err := issueAccessToken(cfg, &session)
 	if err != nil {
 		return nil, err
 	}
 
-	accessToken, err := GenerateAccessToken(userDetail.UserID, sessionID, cfg.AccessTokenExpireMinutes, cfg.RSAPrivateKey)
-	if err != nil {
+	if cfg.MaxSessionsPerUser > 0 {
+		evicted, err := models.CreateSessionWithinLimit(db, &session, sessionLimit(cfg, now))
+		if err != nil {
+			return nil, err
+		}
+		revokeEvictedSessions(db, cfg, evicted, userDetail.UserIP)
+	} else if _, err := models.CreateSession(db, &session); err != nil {
 		return nil, err
 	}
 
-	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
+	return newTokenPair(&session, accessToken, refreshToken), nil
 }
 
 // Generates a new pair of tokens
-func RefreshToken(db *gorm.DB, cfg *config.Config, tokens *TokenPair, userIP string, userAgent string) (*TokenPair, error) {
-	payload, err := GetTokenPayload(tokens.AccessToken, cfg.RSAPublicKey, true)
+func RefreshToken(db *gorm.DB, cfg *config.Config, request *RefreshTokenRequest, client UserInfo) (*TokenPair, error) {
+	sessionID, err := getRefreshTokenSessionID(cfg, request.RefreshToken, request.AccessToken)
 	if err != nil {
-		logrus.WithError(err).Error("Failed get payload from Access token")
 		return nil, err
 	}
 
-	session, err := models.GetSession(db, payload.SID)
+	session, err := models.GetSession(db, sessionID)
 	if err != nil {
-		logrus.WithError(err).Errorf("Failed get session by session ID %s", payload.SID)
+		logrus.WithError(err).Errorf("Failed get session by session ID %s", sessionID)
 		return nil, err
 	}
 	if session == nil {
 		return nil, fmt.Errorf("session not found")
 	}
-	if !CompareRefreshToken(session.RefreshToken, tokens.RefreshToken) {
+	if !CompareRefreshToken(cfg, session.RefreshToken, request.RefreshToken) {
+		if isUsedRefreshToken(db, session.SessionID, request.RefreshToken) {
+			revokeReusedSession(db, cfg, session, client.UserIP)
+			return nil, fmt.Errorf("refresh token reuse detected")
+		}
 		return nil, fmt.Errorf("invalid refresh token")
 	}
 
@@ -81,55 +112,253 @@ func RefreshToken(db *gorm.DB, cfg *config.Config, tokens *TokenPair, userIP str
 		return nil, fmt.Errorf("token has expired")
 	}
 
-	if session.UserAgent != userAgent {
-		models.DeleteSession(db, session.SessionID)
+	if err := checkSessionLifetime(cfg, session, time.Now()); err != nil {
+		if err := RevokeSession(db, session); err != nil {
+			logrus.WithError(err).Errorf("Failed revoke session %s", session.SessionID)
+		}
+		return nil, err
+	}
+
+	// Refresh tokens of bound sessions can only be used with a proof of the same key
+	if session.DPoPJKT != "" && (client.Cnf == nil || client.Cnf.JKT != session.DPoPJKT) {
+		return nil, fmt.Errorf("DPoP proof does not match the session key")
+	}
+	if session.CertThumbprint != "" && (client.Cnf == nil || client.Cnf.X5TS256 != session.CertThumbprint) {
+		return nil, fmt.Errorf("client certificate does not match the session certificate")
+	}
+
+	if session.UserAgent != client.UserAgent {
+		if err := RevokeSession(db, session); err != nil {
+			logrus.WithError(err).Errorf("Failed revoke session %s", session.SessionID)
+			return nil, err
+		}
 		return nil, fmt.Errorf("user agent not equal")
 	}
 
-	if session.IP != userIP {
+	if session.IP != client.UserIP {
 		notificationPayload := NotificationPayload{
+			Event:     EventIPChanged,
 			UserID:    session.UserID,
 			SessionID: session.SessionID,
-			UserIP:    userIP,
+			UserIP:    client.UserIP,
 		}
 
 		Notify(cfg, notificationPayload)
 	}
 
-	refreshToken, err := GenerateRefreshToken()
+	refreshToken, err := GenerateRefreshToken(session.SessionID)
 	if err != nil {
 		logrus.WithError(err).Error("Failed generate refresh token")
 		return nil, fmt.Errorf("failed generate refresh token")
 	}
 
-	accessToken, err := GenerateAccessToken(session.UserID, session.SessionID, cfg.AccessTokenExpireMinutes, cfg.RSAPrivateKey)
+	// Sessions created before scopes were introduced get the default grant
+	if session.Roles == "" {
+		roles, scopes := GrantScopes(cfg, session.UserID, nil)
+		session.Scope = FormatScope(scopes)
+		session.Roles = strings.Join(roles, " ")
+	}
+
+	accessToken, err := issueAccessToken(cfg, session)
 	if err != nil {
 		logrus.WithError(err).Error("Failed generate access token")
 		return nil, fmt.Errorf("failed generate access token")
 	}
 
-	session.ExpireAt = time.Now().Add(time.Duration(cfg.RefreshTokenExpireMinutes) * time.Minute)
-	session.RefreshToken, err = HashRefreshToken(refreshToken)
+	previousRefreshToken := session.RefreshToken
+	session.ExpireAt = sessionExpireAt(cfg, session.CreatedAt, time.Now())
+	session.RefreshToken, err = HashRefreshToken(cfg, refreshToken)
 	if err != nil {
 		logrus.WithError(err).Error("Failed hash refresh token")
 		return nil, fmt.Errorf("failed hash refresh token")
 	}
 
-	err = models.UpdateSession(db, session)
+	err = models.RotateRefreshToken(db, session, previousRefreshToken, refreshTokenFingerprint(request.RefreshToken))
+	if err == models.ErrRefreshTokenAlreadyRotated {
+		// The same refresh token was used by a concurrent request
+		revokeReusedSession(db, cfg, session, client.UserIP)
+		return nil, fmt.Errorf("refresh token reuse detected")
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed update session")
 		return nil, fmt.Errorf("failed update session")
 	}
 
+	// Superseded tokens older than the refresh token lifetime have expired anyway
+	pruneBefore := time.Now().Add(-time.Duration(cfg.RefreshTokenExpireMinutes) * time.Minute)
+	if err := models.PruneUsedRefreshTokens(db, session.SessionID, pruneBefore); err != nil {
+		logrus.WithError(err).Error("Failed prune used refresh tokens")
+	}
+
+	return newTokenPair(session, accessToken, refreshToken), nil
+}
+
+// Checks whether the refresh token was issued for the session and already superseded.
+func isUsedRefreshToken(db *gorm.DB, sessionID string, refreshToken string) bool {
+	used, err := models.IsUsedRefreshToken(db, sessionID, refreshTokenFingerprint(refreshToken))
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed check used refresh tokens of session %s", sessionID)
+		return false
+	}
+	return used
+}
+
+// Revokes the session after a superseded refresh token was replayed and emits a security event.
+// Both the legitimate client and the attacker lose access, the user has to sign in again.
+func revokeReusedSession(db *gorm.DB, cfg *config.Config, session *models.Session, userIP string) {
+	logrus.Warnf("Refresh token reuse detected for session %s of user %s from %s", session.SessionID, session.UserID, userIP)
+
+	if err := RevokeSession(db, session); err != nil {
+		logrus.WithError(err).Errorf("Failed revoke session %s", session.SessionID)
+	}
+
+	Notify(cfg, NotificationPayload{
+		Event:     EventRefreshTokenReuse,
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		UserIP:    userIP,
+	})
+}
+
+// Builds the access token claims for the session.
+func sessionClaims(session *models.Session) CustomClaims {
+	claims := CustomClaims{
+		Subject: session.UserID,
+		SID:     session.SessionID,
+		Scope:   session.Scope,
+		Roles:   strings.Fields(session.Roles),
+	}
+	if session.DPoPJKT != "" || session.CertThumbprint != "" {
+		claims.Cnf = &Confirmation{JKT: session.DPoPJKT, X5TS256: session.CertThumbprint}
+	}
+	return claims
+}
+
+// Certificate-bound tokens are presented with the Bearer scheme (RFC 8705 section 3).
+func newTokenPair(session *models.Session, accessToken string, refreshToken string) *TokenPair {
+	tokenType := "Bearer"
+	if session.DPoPJKT != "" {
+		tokenType = "DPoP"
+	}
+
 	return &TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-	}, nil
+		TokenType:    tokenType,
+	}
 }
 
 // Removes a user's session from the database using the provided session ID.
+// Signing out of a session that was already removed succeeds.
 func SignOut(db *gorm.DB, sessionID string) error {
-	return models.DeleteSession(db, sessionID)
+	session, err := models.GetSession(db, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeSession(db, session)
+}
+
+// Deletes the session and denylists its unexpired access tokens, including the exchanged ones,
+// so they are rejected even where the session is not looked up.
+func RevokeSession(db *gorm.DB, session *models.Session) error {
+	if err := RevokeAccessTokens(db, parseAccessTokenIDs(session.AccessTokenIDs)); err != nil {
+		return err
+	}
+	if err := denylistExchangedAccessTokens(db, []string{session.SessionID}); err != nil {
+		return err
+	}
+	if err := models.DeleteSession(db, session.SessionID); err != nil {
+		return err
+	}
+	return revokeExchangedAccessTokens(db, []string{session.SessionID})
+}
+
+// Revokes the session of an access or refresh token (RFC 7009).
+// Expired access tokens are accepted, so clients can sign out after the access token lifetime.
+// Legacy refresh tokens do not identify their session and are only revoked together with the access token
+// issued with them; the access token alone revokes the same session.
+// Invalid tokens are ignored, the caller must not reveal whether revocation happened.
+func RevokeToken(db *gorm.DB, cfg *config.Config, token string, accessToken string) error {
+	if session, err := GetRefreshTokenSession(db, cfg, token, accessToken); err == nil {
+		return RevokeSession(db, session)
+	}
+
+	if isOpaqueAccessToken(token) {
+		// Legacy refresh tokens contain no dot either and end up here without their access token
+		session, err := models.GetSessionByAccessToken(db, hashOpaqueAccessToken(token))
+		if err != nil {
+			logrus.WithError(err).Info("Revocation of unknown token or legacy refresh token without its access token ignored")
+			return nil
+		}
+		return RevokeSession(db, session)
+	}
+
+	payload, err := GetTokenPayload(cfg, token, true)
+	if err != nil {
+		logrus.WithError(err).Info("Revocation of unknown token ignored")
+		return nil
+	}
+
+	if err := RevokeAccessTokens(db, map[string]time.Time{payload.ID: payload.ExpiresAt.Time}); err != nil {
+		return err
+	}
+
+	session, err := models.GetSession(db, payload.SID)
+	if err != nil {
+		// The session was already revoked
+		return nil
+	}
+	return RevokeSession(db, session)
+}
+
+// Finds the active session a refresh token was issued for.
+// Legacy refresh tokens do not identify the session and are only found together with their access token.
+func GetRefreshTokenSession(db *gorm.DB, cfg *config.Config, refreshToken string, accessToken string) (*models.Session, error) {
+	sessionID, err := getRefreshTokenSessionID(cfg, refreshToken, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := models.GetSession(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !CompareRefreshToken(cfg, session.RefreshToken, refreshToken) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if time.Now().After(session.ExpireAt) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if err := checkSessionLifetime(cfg, session, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Returns the ID of the session the refresh token belongs to.
+// Legacy refresh tokens do not identify the session, it is taken from the access token they were issued with.
+func getRefreshTokenSessionID(cfg *config.Config, refreshToken string, accessToken string) (string, error) {
+	if sessionID, ok := parseRefreshToken(refreshToken); ok {
+		return sessionID, nil
+	}
+
+	if !cfg.AcceptLegacyRefreshTokens {
+		return "", fmt.Errorf("legacy refresh token format is not accepted")
+	}
+	if accessToken == "" {
+		return "", fmt.Errorf("access token is required for legacy refresh tokens")
+	}
+
+	payload, err := getLegacyTokenPayload(cfg, accessToken)
+	if err != nil {
+		logrus.WithError(err).Error("Failed get payload from Access token")
+		return "", err
+	}
+	return payload.SID, nil
 }
 
 // Checks if a session exists in the database for the given session ID.
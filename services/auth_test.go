@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupTestWebhook(t *testing.T, cfg *config.Config) chan NotificationPayload {
+	notifications := make(chan NotificationPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload NotificationPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		notifications <- payload
+	}))
+	t.Cleanup(server.Close)
+
+	cfg.WebhookURL = server.URL
+	return notifications
+}
+
+// Creates a session issued before refresh tokens identified it and returns its ID, access token and refresh token.
+func createLegacySession(t *testing.T, db *gorm.DB, cfg *config.Config) (string, string, string) {
+	legacyRefreshToken := "bGVnYWN5LXJlZnJlc2gtdG9rZW4tMzItYnl0ZXMtbG9uZw=="
+	hashedRefreshToken, err := HashRefreshToken(cfg, legacyRefreshToken)
+	assert.NoError(t, err)
+
+	session := &models.Session{
+		UserID:       "user",
+		IP:           "127.0.0.1",
+		UserAgent:    "test-agent",
+		RefreshToken: hashedRefreshToken,
+		ExpireAt:     time.Now().Add(time.Hour),
+	}
+	sessionID, err := models.CreateSession(db, session)
+	assert.NoError(t, err)
+
+	// Access tokens were signed with RS512 without a key ID and carried no iss, aud, iat or jti
+	legacyClaims := CustomClaims{
+		Subject: session.UserID,
+		SID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)),
+		},
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodRS512, legacyClaims).SignedString(cfg.Keys.SigningKey().PrivateKey)
+	assert.NoError(t, err)
+
+	return sessionID, accessToken, legacyRefreshToken
+}
+
+func TestRefreshTokenWithoutAccessToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	payload, err := ValidateToken(cfg, tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tokenPair.RefreshToken, payload.SID+"."))
+
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	newPayload, err := ValidateToken(cfg, newTokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, payload.SID, newPayload.SID)
+}
+
+func TestRefreshTokenLegacyFormat(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	sessionID, accessToken, legacyRefreshToken := createLegacySession(t, db, cfg)
+
+	_, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: legacyRefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.Error(t, err)
+
+	cfg.AcceptLegacyRefreshTokens = false
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{AccessToken: accessToken, RefreshToken: legacyRefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.Error(t, err)
+
+	cfg.AcceptLegacyRefreshTokens = true
+	tokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{AccessToken: accessToken, RefreshToken: legacyRefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tokenPair.RefreshToken, sessionID+"."))
+}
+
+func TestRevokeToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	err = RevokeToken(db, cfg, "not-a-token", "")
+	assert.NoError(t, err)
+	assert.True(t, IntrospectToken(db, cfg, tokenPair.AccessToken, "").Active)
+
+	err = RevokeToken(db, cfg, tokenPair.AccessToken, "")
+	assert.NoError(t, err)
+	assert.False(t, IntrospectToken(db, cfg, tokenPair.AccessToken, "").Active)
+
+	tokenPair, err = SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	err = RevokeToken(db, cfg, tokenPair.RefreshToken, "")
+	assert.NoError(t, err)
+	assert.False(t, IntrospectToken(db, cfg, tokenPair.RefreshToken, "").Active)
+	assert.False(t, IntrospectToken(db, cfg, tokenPair.AccessToken, "").Active)
+}
+
+func TestRevokeLegacyRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.AcceptLegacyRefreshTokens = true
+
+	_, accessToken, legacyRefreshToken := createLegacySession(t, db, cfg)
+
+	// Without its access token a legacy refresh token cannot be found and is ignored
+	err := RevokeToken(db, cfg, legacyRefreshToken, "")
+	assert.NoError(t, err)
+	assert.True(t, IntrospectToken(db, cfg, legacyRefreshToken, accessToken).Active)
+
+	err = RevokeToken(db, cfg, legacyRefreshToken, accessToken)
+	assert.NoError(t, err)
+	assert.False(t, IntrospectToken(db, cfg, legacyRefreshToken, accessToken).Active)
+	assert.False(t, IntrospectToken(db, cfg, accessToken, "").Active)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	notifications := setupTestWebhook(t, cfg)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	payload, err := GetTokenPayload(cfg, newTokenPair.AccessToken, true)
+	assert.NoError(t, err)
+
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "10.0.0.1", UserAgent: "test-agent"})
+	assert.EqualError(t, err, "refresh token reuse detected")
+
+	_, err = models.GetSession(db, payload.SID)
+	assert.Error(t, err)
+
+	notification := <-notifications
+	assert.Equal(t, EventRefreshTokenReuse, notification.Event)
+	assert.Equal(t, payload.SID, notification.SessionID)
+	assert.Equal(t, "10.0.0.1", notification.UserIP)
+
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: newTokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.Error(t, err)
+}
+
+func TestRefreshTokenUserAgentMismatchRevokesSession(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	sessionID, _, _ := strings.Cut(tokenPair.RefreshToken, ".")
+
+	// A failed revocation is reported instead of leaving the session silently alive
+	assert.NoError(t, db.Migrator().RenameTable("revoked_access_tokens", "revoked_access_tokens_unavailable"))
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "other-agent"})
+	assert.Error(t, err)
+	assert.NotEqual(t, "user agent not equal", err.Error())
+	assert.NoError(t, db.Migrator().RenameTable("revoked_access_tokens_unavailable", "revoked_access_tokens"))
+
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "other-agent"})
+	assert.EqualError(t, err, "user agent not equal")
+
+	_, err = models.GetSession(db, sessionID)
+	assert.Error(t, err)
+	_, err = ValidateToken(cfg, tokenPair.AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	assert.True(t, IntrospectToken(db, cfg, tokenPair.RefreshToken, "").Active)
+
+	// Knowing the session ID is not enough to revoke the session
+	sessionID, _, _ := strings.Cut(tokenPair.RefreshToken, ".")
+	err = RevokeToken(db, cfg, sessionID+".forged-secret", "")
+	assert.NoError(t, err)
+	assert.True(t, IntrospectToken(db, cfg, tokenPair.AccessToken, "").Active)
+
+	err = RevokeToken(db, cfg, tokenPair.RefreshToken, "")
+	assert.NoError(t, err)
+	assert.False(t, IntrospectToken(db, cfg, tokenPair.AccessToken, "").Active)
+	assert.False(t, IntrospectToken(db, cfg, tokenPair.RefreshToken, "").Active)
+}
+
+func TestRefreshTokenUpgradesHash(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	cfg.RefreshTokenHashAlgorithm = HashAlgorithmHMACSHA256
+	cfg.RefreshTokenHashKey = "test-key"
+
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	session, err := GetRefreshTokenSession(db, cfg, newTokenPair.RefreshToken, "")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(session.RefreshToken, "$hmac-sha256$"))
+}
+
+func TestSignOutRevokesAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	payload, err := ValidateToken(cfg, newTokenPair.AccessToken)
+	assert.NoError(t, err)
+
+	err = SignOut(db, payload.SID)
+	assert.NoError(t, err)
+
+	// Both access tokens of the session are denied without looking up the session
+	_, err = ValidateToken(cfg, tokenPair.AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+	_, err = ValidateToken(cfg, newTokenPair.AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+
+	revokedTokens, err := models.GetRevokedAccessTokens(db, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, revokedTokens, 2)
+
+	// The session is already gone, signing out again still succeeds
+	err = SignOut(db, payload.SID)
+	assert.NoError(t, err)
+}
+
+func TestRefreshTokenSessionLifetime(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.SessionMaxAgeMinutes = 24 * 60
+	cfg.SessionIdleTimeoutMinutes = 30
+	client := UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"}
+
+	for _, test := range []struct {
+		name      string
+		createdAt time.Time
+		updatedAt time.Time
+		err       string
+	}{
+		{"max age", time.Now().Add(-25 * time.Hour), time.Now(), "session exceeded the maximum lifetime"},
+		{"idle timeout", time.Now().Add(-time.Hour), time.Now().Add(-31 * time.Minute), "session exceeded the idle timeout"},
+	} {
+		tokenPair, err := SignIn(db, cfg, client)
+		assert.NoError(t, err)
+		sessionID, _ := parseRefreshToken(tokenPair.RefreshToken)
+
+		err = db.Model(&models.Session{}).Where("session_id = ?", sessionID).
+			UpdateColumns(map[string]any{"created_at": test.createdAt, "updated_at": test.updatedAt}).Error
+		assert.NoError(t, err)
+
+		_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, client)
+		assert.EqualError(t, err, test.err, test.name)
+
+		_, err = models.GetSession(db, sessionID)
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestRefreshTokenExpiryCappedBySessionLifetime(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.SessionMaxAgeMinutes = 30
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	session, err := GetRefreshTokenSession(db, cfg, tokenPair.RefreshToken, "")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, session.CreatedAt.Add(30*time.Minute), session.ExpireAt, time.Second)
+}
@@ -2,93 +2,195 @@ package services
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"encoding/base64"
 	"fmt"
+	"simpleAuth/config"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
 // JWT Payload
 type CustomClaims struct {
-	Subject string `json:"sub"` // User ID
-	SID     string `json:"sid"` // Session ID
+	Subject string        `json:"sub"`             // User ID
+	SID     string        `json:"sid"`             // Session ID
+	Scope   string        `json:"scope,omitempty"` // Space-delimited granted scopes
+	Roles   []string      `json:"roles,omitempty"` // User roles
+	Cnf     *Confirmation `json:"cnf,omitempty"`   // Key the token is bound to
+	Act     *Actor        `json:"act,omitempty"`   // Party acting on behalf of the subject
 	jwt.RegisteredClaims
 }
 
-// Creates a new refresh token using random bytes and encodes it in base64.
-func GenerateRefreshToken() (string, error) {
+// Creates a new refresh token in the "sid.secret" format, the secret is random bytes encoded in base64.
+// Embedding the session ID allows refreshing without the access token.
+func GenerateRefreshToken(sessionID string) (string, error) {
 	tokenBytes := make([]byte, 32)
 	_, err := rand.Read(tokenBytes)
 	if err != nil {
 		return "", err
 	}
 
-	refreshToken := base64.StdEncoding.EncodeToString(tokenBytes)
+	refreshToken := sessionID + "." + base64.RawURLEncoding.EncodeToString(tokenBytes)
 	return refreshToken, nil
 }
 
-// Creates a new access token for a user with a specified expiration time.
-func GenerateAccessToken(userID string, sessionID string, accessTokenExpireMinutes int16, privateKey *rsa.PrivateKey) (string, error) {
-	claims := CustomClaims{
-		Subject: userID,
-		SID:     sessionID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(accessTokenExpireMinutes) * time.Minute)),
-		},
+// Extracts the session ID from a refresh token in the "sid.secret" format.
+// Legacy refresh tokens are plain base64 and never contain a dot.
+func parseRefreshToken(refreshToken string) (string, bool) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || secret == "" {
+		return "", false
 	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return "", false
+	}
+	return sessionID, true
+}
+
+// Creates a new access token with the given subject and session claims in the configured format.
+// The registered claims (iss, aud, iat, nbf, exp, jti) are filled from the configuration,
+// and the key ID is included so verifiers can select the key from the JWKS.
+func GenerateAccessToken(cfg *config.Config, claims *CustomClaims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    cfg.TokenIssuer,
+		Audience:  cfg.TokenAudience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)),
+		ID:        uuid.New().String(),
+	}
+
+	return signAccessToken(cfg, claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+// Signs the claims in the configured self-contained format, JWT in the opaque mode,
+// and encrypts the token when encryption is configured.
+func signAccessToken(cfg *config.Config, claims *CustomClaims) (string, error) {
+	token, err := issuedTokenFormat(cfg).Encode(cfg.Keys.SigningKey(), claims)
+	if err != nil || cfg.EncryptionKey == nil {
+		return token, err
+	}
+	return encryptToken(cfg.EncryptionKey, token)
+}
 
-	tokenString, err := token.SignedString(privateKey)
+// Checks the validity of the provided token string using the configured keys, issuer and audience,
+// and rejects revoked tokens.
+func ValidateToken(cfg *config.Config, tokenString string) (*CustomClaims, error) {
+	claims, err := GetTokenPayload(cfg, tokenString, false)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
-}
+	if IsAccessTokenRevoked(claims.ID) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
 
-// Checks the validity of the provided token string using the public key.
-func ValidateToken(tokenString string, publicKey *rsa.PublicKey) (*CustomClaims, error) {
-	return GetTokenPayload(tokenString, publicKey, false)
+	return claims, nil
 }
 
-// Parses the token string and retrieves the claims, optionally skipping validation.
-func GetTokenPayload(tokenString string, publicKey *rsa.PublicKey, skipValidation bool) (*CustomClaims, error) {
-	var options []jwt.ParserOption
+// Parses the token string of any supported format and retrieves the claims, optionally skipping validation of the time based claims.
+// The issuer and audience are always checked, so tokens minted by another environment are never accepted.
+// Encrypted tokens are decrypted first, plain signed tokens are accepted alongside them.
+func GetTokenPayload(cfg *config.Config, tokenString string, skipValidation bool) (*CustomClaims, error) {
+	if isEncryptedToken(tokenString) {
+		var err error
+		if tokenString, err = decryptToken(cfg.EncryptionKey, tokenString); err != nil {
+			return nil, err
+		}
+	}
 
-	if skipValidation {
-		options = append(options, jwt.WithoutClaimsValidation())
+	claims, err := tokenFormatOf(tokenString).Decode(cfg.Keys, tokenString)
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if !skipValidation {
+		validator := jwt.NewValidator(
+			jwt.WithLeeway(time.Duration(cfg.TokenLeewaySeconds)*time.Second),
+			jwt.WithIssuedAt(),
+			jwt.WithExpirationRequired(),
+		)
+		if err := validator.Validate(claims); err != nil {
+			return nil, err
 		}
-		return publicKey, nil
-	}, options...)
+	}
 
+	if err := validateIssuerAndAudience(cfg, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Parses the access token issued together with a legacy refresh token and retrieves the claims.
+// Only the signature and the session ID are checked: access tokens issued before the registered claims
+// carry no issuer or audience, those are validated only for tokens that have an issuer.
+func getLegacyTokenPayload(cfg *config.Config, tokenString string) (*CustomClaims, error) {
+	if isEncryptedToken(tokenString) {
+		var err error
+		if tokenString, err = decryptToken(cfg.EncryptionKey, tokenString); err != nil {
+			return nil, err
+		}
+	}
+
+	claims, err := tokenFormatOf(tokenString).Decode(cfg.Keys, tokenString)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		return claims, nil
+
+	if claims.Issuer != "" {
+		if err := validateIssuerAndAudience(cfg, claims); err != nil {
+			return nil, err
+		}
+	}
+	if claims.SID == "" {
+		return nil, fmt.Errorf("token has no session ID")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return claims, nil
 }
 
-func HashRefreshToken(token string) (string, error) {
-	hashedToken, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+// Checks that the token was issued by this environment for one of the configured audiences.
+func validateIssuerAndAudience(cfg *config.Config, claims *CustomClaims) error {
+	if claims.Issuer != cfg.TokenIssuer {
+		return fmt.Errorf("unexpected token issuer: %s", claims.Issuer)
+	}
+	if !slices.ContainsFunc(claims.Audience, func(audience string) bool {
+		return slices.Contains(cfg.TokenAudience, audience)
+	}) {
+		return fmt.Errorf("unexpected token audience: %v", claims.Audience)
+	}
+	return nil
+}
+
+// Returns the secret part of the refresh token that is stored hashed, legacy tokens are hashed whole.
+func refreshTokenSecret(refreshToken string) string {
+	if _, ok := parseRefreshToken(refreshToken); ok {
+		_, secret, _ := strings.Cut(refreshToken, ".")
+		return secret
+	}
+	return refreshToken
+}
+
+// Hashes the refresh token with the configured algorithm.
+func HashRefreshToken(cfg *config.Config, token string) (string, error) {
+	hasher, err := NewRefreshTokenHasher(cfg)
 	if err != nil {
 		return "", err
 	}
-	return string(hashedToken), nil
+	return hasher.Hash(refreshTokenSecret(token))
 }
 
-func CompareRefreshToken(hashedToken string, token string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedToken), []byte(token))
-	return err == nil
+// Compares the refresh token with a stored hash of any supported algorithm.
+// Tokens hashed with a previous algorithm are upgraded on the next refresh, when the rotated token is hashed.
+func CompareRefreshToken(cfg *config.Config, hashedToken string, token string) bool {
+	hasher, err := refreshTokenHasherFor(cfg, hashedToken)
+	if err != nil {
+		return false
+	}
+	return hasher.Compare(hashedToken, refreshTokenSecret(token))
 }
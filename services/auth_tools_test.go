@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"simpleAuth/config"
+	"simpleAuth/logger"
+	"simpleAuth/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.CustomGormLogger(),
+	})
+	assert.NoError(t, err)
+
+	err = db.AutoMigrate(&models.Session{}, &models.UsedRefreshToken{}, &models.RevokedAccessToken{}, &models.ExchangedAccessToken{})
+	assert.NoError(t, err)
+
+	return db
+}
+
+// RSA key shared by the tests that do not depend on the signing algorithm, generating a key per test is slow
+var testRSAKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+func setupTestConfig(t *testing.T) *config.Config {
+	return setupTestConfigWithKey(t, config.AlgorithmRS512, testRSAKey())
+}
+
+func setupTestConfigWithKey(t *testing.T, algorithm string, privateKey crypto.Signer) *config.Config {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	assert.NoError(t, err)
+
+	keys, err := config.LoadKeyRing(config.PEMKeySource{Dir: dir}, "", algorithm, time.Hour)
+	assert.NoError(t, err)
+
+	return &config.Config{
+		AccessTokenExpireMinutes:  10,
+		RefreshTokenExpireMinutes: 60,
+		TokenIssuer:               "https://auth.test",
+		TokenAudience:             []string{"api"},
+		TokenLeewaySeconds:        30,
+		RefreshTokenHashAlgorithm: HashAlgorithmBcrypt,
+		Keys:                      keys,
+	}
+}
+
+func TestAccessTokenAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for algorithm, privateKey := range map[string]crypto.Signer{
+		config.AlgorithmRS512: rsaKey,
+		config.AlgorithmPS256: rsaKey,
+		config.AlgorithmES256: ecKey,
+		config.AlgorithmEdDSA: edKey,
+	} {
+		cfg := setupTestConfigWithKey(t, algorithm, privateKey)
+
+		tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+		assert.NoError(t, err)
+
+		token, _, err := jwt.NewParser().ParseUnverified(tokenString, &CustomClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, token.Header["alg"])
+		assert.Equal(t, cfg.Keys.SigningKey().ID, token.Header["kid"])
+
+		claims, err := ValidateToken(cfg, tokenString)
+		assert.NoError(t, err)
+		assert.Equal(t, "user", claims.Subject)
+		assert.Equal(t, "session", claims.SID)
+	}
+}
+
+func TestValidateTokenRejectsForeignAlgorithm(t *testing.T) {
+	cfg := setupTestConfig(t)
+
+	// HMAC signed with the public key bytes must not be accepted
+	publicDER, err := x509.MarshalPKIXPublicKey(&testRSAKey().PublicKey)
+	assert.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{
+		Subject: "user",
+		SID:     "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.TokenIssuer,
+			Audience:  cfg.TokenAudience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	token.Header["kid"] = cfg.Keys.SigningKey().ID
+	tokenString, err := token.SignedString(publicDER)
+	assert.NoError(t, err)
+
+	_, err = ValidateToken(cfg, tokenString)
+	assert.Error(t, err)
+}
+
+func TestAccessTokenRegisteredClaims(t *testing.T) {
+	cfg := setupTestConfig(t)
+
+	tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+
+	claims, err := ValidateToken(cfg, tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.TokenIssuer, claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings(cfg.TokenAudience), claims.Audience)
+	assert.NotNil(t, claims.IssuedAt)
+	assert.NotNil(t, claims.NotBefore)
+	assert.NotEmpty(t, claims.ID)
+
+	otherToken, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+	otherClaims, err := ValidateToken(cfg, otherToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, claims.ID, otherClaims.ID)
+}
+
+func TestValidateTokenRejectsForeignIssuerAndAudience(t *testing.T) {
+	cfg := setupTestConfig(t)
+
+	stagingCfg := *cfg
+	stagingCfg.TokenIssuer = "https://auth.staging.test"
+	tokenString, err := GenerateAccessToken(&stagingCfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+	_, err = ValidateToken(cfg, tokenString)
+	assert.Error(t, err)
+
+	otherAudienceCfg := *cfg
+	otherAudienceCfg.TokenAudience = []string{"other-api"}
+	tokenString, err = GenerateAccessToken(&otherAudienceCfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+	_, err = ValidateToken(cfg, tokenString)
+	assert.Error(t, err)
+}
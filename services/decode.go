@@ -0,0 +1,46 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"simpleAuth/config"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Decodes the header and claims of a self-contained access token without verifying it, for debugging.
+// Encrypted tokens are decrypted when the configured key allows it.
+func DecodeTokenUnverified(cfg *config.Config, token string) (header map[string]any, claims map[string]any, err error) {
+	if isEncryptedToken(token) {
+		if token, err = decryptToken(cfg.EncryptionKey, token); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if strings.HasPrefix(token, pasetoV4PublicHeader) {
+		payload, _, footer, err := splitPASETO(token)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		header = map[string]any{"version": "v4", "purpose": "public"}
+		if len(footer) > 0 {
+			header["footer"] = string(footer)
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return nil, nil, fmt.Errorf("invalid PASETO claims: %v", err)
+		}
+		return header, claims, nil
+	}
+
+	if isOpaqueAccessToken(token) {
+		return nil, nil, fmt.Errorf("opaque access tokens carry no claims, use introspection")
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed.Header, parsed.Claims.(jwt.MapClaims), nil
+}
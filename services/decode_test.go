@@ -0,0 +1,31 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTokenUnverified(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	cfg := setupTestConfigWithKey(t, config.AlgorithmEdDSA, edKey)
+
+	for _, format := range []string{config.AccessTokenFormatJWT, config.AccessTokenFormatPASETO} {
+		cfg.AccessTokenFormat = format
+		token, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+		assert.NoError(t, err)
+
+		header, claims, err := DecodeTokenUnverified(cfg, token)
+		assert.NoError(t, err, format)
+		assert.NotEmpty(t, header, format)
+		assert.Equal(t, "user", claims["sub"], format)
+		assert.Equal(t, "session", claims["sid"], format)
+	}
+
+	_, _, err = DecodeTokenUnverified(cfg, "opaque-token")
+	assert.EqualError(t, err, "opaque access tokens carry no claims, use introspection")
+}
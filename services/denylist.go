@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"simpleAuth/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// In-memory list of revoked access token IDs, persisted in the database.
+// Entries are kept only until the token expires, so the list is bounded by the access token lifetime.
+type tokenDenylist struct {
+	mu       sync.RWMutex
+	entries  map[string]time.Time // Token ID to token expiration
+	syncedAt time.Time
+}
+
+var accessTokenDenylist = &tokenDenylist{entries: make(map[string]time.Time)}
+
+// Reports whether the access token with the given ID was revoked.
+func IsAccessTokenRevoked(tokenID string) bool {
+	accessTokenDenylist.mu.RLock()
+	defer accessTokenDenylist.mu.RUnlock()
+
+	expireAt, ok := accessTokenDenylist.entries[tokenID]
+	return ok && time.Now().Before(expireAt)
+}
+
+// Revokes access tokens by their IDs until they expire.
+func RevokeAccessTokens(db *gorm.DB, tokens map[string]time.Time) error {
+	var revokedTokens []models.RevokedAccessToken
+	now := time.Now()
+	for tokenID, expireAt := range tokens {
+		if expireAt.After(now) {
+			revokedTokens = append(revokedTokens, models.RevokedAccessToken{JTI: tokenID, ExpireAt: expireAt})
+		}
+	}
+
+	accessTokenDenylist.mu.Lock()
+	for _, token := range revokedTokens {
+		accessTokenDenylist.entries[token.JTI] = token.ExpireAt
+	}
+	accessTokenDenylist.mu.Unlock()
+
+	return models.CreateRevokedAccessTokens(db, revokedTokens)
+}
+
+// Loads tokens revoked by other replicas and drops expired entries.
+func SyncTokenDenylist(db *gorm.DB) error {
+	accessTokenDenylist.mu.RLock()
+	// Overlap with the previous sync to tolerate clock differences between replicas
+	since := accessTokenDenylist.syncedAt.Add(-time.Minute)
+	accessTokenDenylist.mu.RUnlock()
+
+	syncedAt := time.Now()
+	revokedTokens, err := models.GetRevokedAccessTokens(db, since)
+	if err != nil {
+		return err
+	}
+
+	accessTokenDenylist.mu.Lock()
+	for _, token := range revokedTokens {
+		accessTokenDenylist.entries[token.JTI] = token.ExpireAt
+	}
+	for tokenID, expireAt := range accessTokenDenylist.entries {
+		if !syncedAt.Before(expireAt) {
+			delete(accessTokenDenylist.entries, tokenID)
+		}
+	}
+	accessTokenDenylist.syncedAt = syncedAt
+	accessTokenDenylist.mu.Unlock()
+
+	return models.DeleteExpiredRevokedAccessTokens(db)
+}
+
+// Loads the denylist and keeps it in sync with the database in the background.
+func StartTokenDenylistSync(db *gorm.DB, interval time.Duration) {
+	if err := SyncTokenDenylist(db); err != nil {
+		logrus.WithError(err).Fatal("Failed load access token denylist")
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := SyncTokenDenylist(db); err != nil {
+				logrus.WithError(err).Error("Failed sync access token denylist")
+			}
+		}
+	}()
+}
+
+// Records an issued access token in the session's space-delimited "jti@exp" list, dropping expired ones.
+func trackAccessToken(accessTokenIDs string, claims *CustomClaims) string {
+	tokens := parseAccessTokenIDs(accessTokenIDs)
+	tokens[claims.ID] = claims.ExpiresAt.Time
+
+	var entries []string
+	now := time.Now()
+	for tokenID, expireAt := range tokens {
+		if expireAt.After(now) {
+			entries = append(entries, fmt.Sprintf("%s@%d", tokenID, expireAt.Unix()))
+		}
+	}
+	return strings.Join(entries, " ")
+}
+
+// Parses the session's list of issued access tokens.
+func parseAccessTokenIDs(accessTokenIDs string) map[string]time.Time {
+	tokens := make(map[string]time.Time)
+	for _, entry := range strings.Fields(accessTokenIDs) {
+		tokenID, expireAt, ok := strings.Cut(entry, "@")
+		if !ok {
+			continue
+		}
+		expireUnix, err := strconv.ParseInt(expireAt, 10, 64)
+		if err != nil {
+			continue
+		}
+		tokens[tokenID] = time.Unix(expireUnix, 0)
+	}
+	return tokens
+}
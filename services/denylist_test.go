@@ -0,0 +1,42 @@
+package services
+
+import (
+	"simpleAuth/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTokenDenylist(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Revoked by another replica
+	tokenID := uuid.New().String()
+	err := models.CreateRevokedAccessTokens(db, []models.RevokedAccessToken{{JTI: tokenID, ExpireAt: time.Now().Add(time.Minute)}})
+	assert.NoError(t, err)
+	assert.False(t, IsAccessTokenRevoked(tokenID))
+
+	err = SyncTokenDenylist(db)
+	assert.NoError(t, err)
+	assert.True(t, IsAccessTokenRevoked(tokenID))
+}
+
+func TestTrackAccessToken(t *testing.T) {
+	expiredClaims := &CustomClaims{}
+	expiredClaims.ID = "expired"
+	expiredClaims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	activeClaims := &CustomClaims{}
+	activeClaims.ID = "active"
+	activeClaims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	accessTokenIDs := trackAccessToken("", expiredClaims)
+	accessTokenIDs = trackAccessToken(accessTokenIDs, activeClaims)
+
+	tokens := parseAccessTokenIDs(accessTokenIDs)
+	assert.Len(t, tokens, 1)
+	assert.Contains(t, tokens, "active")
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"simpleAuth/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Maximum age of a DPoP proof, proofs are single use within this window
+const dpopProofLifetime = time.Minute
+
+// Signing algorithms accepted for DPoP proofs
+var dpopSigningMethods = []string{"RS256", "RS512", "PS256", "ES256", "EdDSA"}
+
+// Key binding of sender-constrained tokens ("cnf" claim, RFC 7800)
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`      // SHA-256 JWK thumbprint of the DPoP key (RFC 9449)
+	X5TS256 string `json:"x5t#S256,omitempty"` // SHA-256 thumbprint of the client certificate (RFC 8705)
+}
+
+// Reports whether the client proved every key the token is bound to.
+func (c *Confirmation) ProvenBy(client *Confirmation) bool {
+	if c == nil {
+		return true
+	}
+	return (c.JKT == "" || (client != nil && client.JKT == c.JKT)) &&
+		(c.X5TS256 == "" || (client != nil && client.X5TS256 == c.X5TS256))
+}
+
+// Computes the "x5t#S256" thumbprint of a DER encoded certificate.
+func CertificateThumbprint(certificateDER []byte) string {
+	sum := sha256.Sum256(certificateDER)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// DPoP proof JWT payload
+type DPoPClaims struct {
+	HTM string `json:"htm"`           // HTTP method of the request
+	HTU string `json:"htu"`           // HTTP URL of the request without query and fragment
+	ATH string `json:"ath,omitempty"` // Hash of the access token presented with the proof
+	jwt.RegisteredClaims
+}
+
+// Cache of used proof IDs to reject replayed proofs.
+type dpopReplayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // Proof ID to expiration
+	order   []string             // Proof IDs in expiration order, all proofs live equally long
+}
+
+var dpopProofs = &dpopReplayCache{entries: make(map[string]time.Time)}
+
+// Records the proof ID, reports false if it was already used.
+// Only the expired proofs at the front of the queue are evicted, so a call costs amortized constant time.
+func (r *dpopReplayCache) use(proofID string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(r.order) > 0 && now.After(r.entries[r.order[0]]) {
+		delete(r.entries, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	if _, ok := r.entries[proofID]; ok {
+		return false
+	}
+	r.entries[proofID] = now.Add(2 * dpopProofLifetime)
+	r.order = append(r.order, proofID)
+	return true
+}
+
+// Verifies a DPoP proof for the request and returns the thumbprint of the proof key.
+// The access token is empty when the proof is presented to obtain tokens.
+func VerifyDPoPProof(cfg *config.Config, proof string, method string, requestURL string, accessToken string) (string, error) {
+	if proof == "" {
+		return "", fmt.Errorf("DPoP proof is missing")
+	}
+
+	leeway := time.Duration(cfg.TokenLeewaySeconds) * time.Second
+
+	var publicKey crypto.PublicKey
+	token, err := jwt.ParseWithClaims(proof, &DPoPClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected DPoP proof type: %v", token.Header["typ"])
+		}
+
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("DPoP proof key is missing")
+		}
+
+		var err error
+		if publicKey, err = parsePublicJWK(jwk); err != nil {
+			return nil, err
+		}
+		return publicKey, nil
+	}, jwt.WithValidMethods(dpopSigningMethods), jwt.WithIssuedAt(), jwt.WithLeeway(leeway))
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(*DPoPClaims)
+	if !ok || !token.Valid {
+		return "", fmt.Errorf("invalid DPoP proof")
+	}
+
+	if claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > dpopProofLifetime+leeway {
+		return "", fmt.Errorf("DPoP proof is too old")
+	}
+	if !strings.EqualFold(claims.HTM, method) {
+		return "", fmt.Errorf("DPoP proof method mismatch")
+	}
+	if !sameRequestURL(claims.HTU, requestURL) {
+		return "", fmt.Errorf("DPoP proof URL mismatch")
+	}
+	if accessToken != "" {
+		tokenHash := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(tokenHash[:]) {
+			return "", fmt.Errorf("DPoP proof access token hash mismatch")
+		}
+	}
+	if claims.ID == "" || !dpopProofs.use(claims.ID, time.Now()) {
+		return "", fmt.Errorf("DPoP proof replayed")
+	}
+
+	return config.KeyThumbprint(publicKey)
+}
+
+// Compares the "htu" claim with the request URL ignoring query and fragment (RFC 9449 section 4.3).
+func sameRequestURL(htu string, requestURL string) bool {
+	proofURL, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	actualURL, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(proofURL.Scheme, actualURL.Scheme) &&
+		strings.EqualFold(proofURL.Host, actualURL.Host) &&
+		proofURL.Path == actualURL.Path
+}
+
+// Parses a public JWK of the key types supported for signing.
+func parsePublicJWK(jwk map[string]interface{}) (crypto.PublicKey, error) {
+	param := func(name string) ([]byte, error) {
+		value, ok := jwk[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("JWK parameter %s is missing", name)
+		}
+		return base64.RawURLEncoding.DecodeString(value)
+	}
+
+	if _, ok := jwk["d"]; ok {
+		return nil, fmt.Errorf("JWK contains a private key")
+	}
+
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := param("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := param("e")
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %v", jwk["crv"])
+		}
+		x, err := param("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := param("y")
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+		// Reject points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk["crv"] != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %v", jwk["crv"])
+		}
+		x, err := param("x")
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %v", jwk["kty"])
+}
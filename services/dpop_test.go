@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"simpleAuth/config"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDPoPProof(t *testing.T, privateKey *ecdsa.PrivateKey, method string, url string, accessToken string) string {
+	params, err := config.JWKParams(&privateKey.PublicKey)
+	assert.NoError(t, err)
+
+	claims := DPoPClaims{
+		HTM: method,
+		HTU: url,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.New().String(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if accessToken != "" {
+		tokenHash := sha256.Sum256([]byte(accessToken))
+		claims.ATH = base64.RawURLEncoding.EncodeToString(tokenHash[:])
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = params
+
+	proof, err := token.SignedString(privateKey)
+	assert.NoError(t, err)
+	return proof
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	cfg := &config.Config{TokenLeewaySeconds: 30}
+	dpopKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	expectedJKT, err := config.KeyThumbprint(&dpopKey.PublicKey)
+	assert.NoError(t, err)
+
+	proof := newTestDPoPProof(t, dpopKey, "POST", "https://auth.test/auth/refresh", "")
+	jkt, err := VerifyDPoPProof(cfg, proof, "POST", "https://auth.test/auth/refresh", "")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedJKT, jkt)
+
+	_, err = VerifyDPoPProof(cfg, proof, "POST", "https://auth.test/auth/refresh", "")
+	assert.EqualError(t, err, "DPoP proof replayed")
+
+	proof = newTestDPoPProof(t, dpopKey, "POST", "https://auth.test/auth/refresh", "")
+	_, err = VerifyDPoPProof(cfg, proof, "GET", "https://auth.test/auth/refresh", "")
+	assert.EqualError(t, err, "DPoP proof method mismatch")
+
+	proof = newTestDPoPProof(t, dpopKey, "POST", "https://auth.test/auth/refresh", "")
+	_, err = VerifyDPoPProof(cfg, proof, "POST", "https://other.test/auth/refresh", "")
+	assert.EqualError(t, err, "DPoP proof URL mismatch")
+
+	proof = newTestDPoPProof(t, dpopKey, "GET", "https://auth.test/users/me", "access-token")
+	_, err = VerifyDPoPProof(cfg, proof, "GET", "https://auth.test/users/me?page=1", "other-access-token")
+	assert.EqualError(t, err, "DPoP proof access token hash mismatch")
+}
+
+func TestDPoPBoundSession(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	dpopKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	jkt, err := config.KeyThumbprint(&dpopKey.PublicKey)
+	assert.NoError(t, err)
+
+	client := UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent", Cnf: &Confirmation{JKT: jkt}}
+	tokenPair, err := SignIn(db, cfg, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "DPoP", tokenPair.TokenType)
+
+	claims, err := ValidateToken(cfg, tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, jkt, claims.Cnf.JKT)
+
+	// A stolen refresh token cannot be used without the DPoP key
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.Error(t, err)
+
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "DPoP", newTokenPair.TokenType)
+}
+
+func TestCertificateBoundSession(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	thumbprint := CertificateThumbprint([]byte("client certificate"))
+	client := UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent", Cnf: &Confirmation{X5TS256: thumbprint}}
+	tokenPair, err := SignIn(db, cfg, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", tokenPair.TokenType)
+
+	claims, err := ValidateToken(cfg, tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, thumbprint, claims.Cnf.X5TS256)
+
+	// The refresh token is only accepted over a connection with the same certificate
+	otherClient := UserInfo{UserIP: "127.0.0.1", UserAgent: "test-agent", Cnf: &Confirmation{X5TS256: CertificateThumbprint([]byte("other certificate"))}}
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, otherClient)
+	assert.EqualError(t, err, "client certificate does not match the session certificate")
+
+	_, err = RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, client)
+	assert.NoError(t, err)
+}
+
+func TestDPoPReplayCacheEvictsExpiredProofs(t *testing.T) {
+	cache := &dpopReplayCache{entries: make(map[string]time.Time)}
+	now := time.Now()
+
+	assert.True(t, cache.use("first", now))
+	assert.True(t, cache.use("second", now.Add(time.Second)))
+	assert.False(t, cache.use("first", now.Add(time.Second)))
+
+	// Once the first proof expires it is evicted, later proofs stay
+	now = now.Add(2*dpopProofLifetime + time.Millisecond)
+	assert.True(t, cache.use("third", now))
+	assert.Len(t, cache.entries, 2)
+	assert.Equal(t, []string{"second", "third"}, cache.order)
+	assert.False(t, cache.use("second", now))
+}
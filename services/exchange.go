@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Token exchange identifiers (RFC 8693 section 3)
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Token exchange errors (RFC 8693 section 2.2.2)
+var (
+	ErrUnsupportedTokenType = errors.New("unsupported token type")
+	ErrInvalidGrant         = errors.New("invalid subject or actor token")
+	ErrInvalidActor         = errors.New("actor token lacks the token exchange scope")
+	ErrInvalidScope         = errors.New("requested scope exceeds the subject token scope")
+	ErrInvalidTarget        = errors.New("requested audience is not served")
+)
+
+// Party acting on behalf of the subject ("act" claim, RFC 8693 section 4.1).
+// The nested actor is the previous actor of a delegation chain.
+type Actor struct {
+	Subject string `json:"sub"`           // User or client ID of the actor
+	Act     *Actor `json:"act,omitempty"` // Previous actor
+}
+
+// Token exchange request (RFC 8693 section 2.1)
+type TokenExchangeRequest struct {
+	GrantType        string   `form:"grant_type"         binding:"required"`
+	SubjectToken     string   `form:"subject_token"      binding:"required"`
+	SubjectTokenType string   `form:"subject_token_type" binding:"required"`
+	ActorToken       string   `form:"actor_token"`
+	ActorTokenType   string   `form:"actor_token_type"`
+	Scope            string   `form:"scope"`
+	Audience         []string `form:"audience"`
+}
+
+// Token exchange response (RFC 8693 section 2.2.1)
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// Returns the subjects of the actor chain, the current actor first.
+func (a *Actor) Chain() []string {
+	var chain []string
+	for actor := a; actor != nil; actor = actor.Act {
+		chain = append(chain, actor.Subject)
+	}
+	return chain
+}
+
+// Issues an access token for the subject of the subject token acting through the actor (RFC 8693).
+// The actor is the subject of the actor token, which needs the token exchange scope of the actor role,
+// or the client itself when no actor token is given.
+// The new token never has more scopes, audiences or lifetime than the subject token and belongs to the same session,
+// so revoking the session revokes it as well. Sender-constrained subject tokens can only be exchanged
+// with a proof of the same key, the new token is bound to the key proven by the client.
+func ExchangeToken(db *gorm.DB, cfg *config.Config, request *TokenExchangeRequest, clientID string, client UserInfo) (*TokenExchangeResponse, error) {
+	subject, err := exchangedTokenClaims(db, cfg, request.SubjectToken, request.SubjectTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if !subject.Cnf.ProvenBy(client.Cnf) {
+		return nil, ErrInvalidGrant
+	}
+
+	actor := &Actor{Subject: clientID, Act: subject.Act}
+	if request.ActorToken != "" {
+		actorClaims, err := exchangedTokenClaims(db, cfg, request.ActorToken, request.ActorTokenType)
+		if err != nil {
+			return nil, err
+		}
+		if !actorClaims.Cnf.ProvenBy(client.Cnf) {
+			return nil, ErrInvalidGrant
+		}
+		// Any user could act on behalf of others otherwise
+		if !slices.Contains(ParseScope(actorClaims.Scope), ScopeTokenExchange) {
+			return nil, ErrInvalidActor
+		}
+		actor.Subject = actorClaims.Subject
+	}
+
+	grantedScopes := ParseScope(subject.Scope)
+	scopes := grantedScopes
+	if request.Scope != "" {
+		scopes = ParseScope(request.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(grantedScopes, scope) {
+				return nil, ErrInvalidScope
+			}
+		}
+	}
+
+	audience := []string(subject.Audience)
+	if len(request.Audience) > 0 {
+		for _, requested := range request.Audience {
+			if !slices.Contains(subject.Audience, requested) || !slices.Contains(cfg.TokenAudience, requested) {
+				return nil, ErrInvalidTarget
+			}
+		}
+		audience = request.Audience
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	claims := CustomClaims{
+		Subject: subject.Subject,
+		SID:     subject.SID,
+		Scope:   FormatScope(scopes),
+		Roles:   subject.Roles,
+		Cnf:     client.Cnf,
+		Act:     actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.TokenIssuer,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	accessToken, err := signAccessToken(cfg, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Track the token, so it is denylisted together with the session. The session is checked after the token
+	// is recorded: a revocation either removed the session before, or finds the token when it denylists them.
+	err = models.CreateExchangedAccessToken(db, &models.ExchangedAccessToken{JTI: claims.ID, SessionID: claims.SID, ExpireAt: expiresAt})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := CheckSessionExists(db, claims.SID); err != nil {
+		if err := RevokeAccessTokens(db, map[string]time.Time{claims.ID: expiresAt}); err != nil {
+			logrus.WithError(err).Errorf("Failed revoke access token exchanged for revoked session %s", claims.SID)
+		}
+		return nil, ErrInvalidGrant
+	}
+	if err := models.PruneExchangedAccessTokens(db, claims.SID); err != nil {
+		logrus.WithError(err).Error("Failed prune exchanged access tokens")
+	}
+
+	logrus.Infof("Token exchange: user %s session %s actors %v via client %s, scope %q", claims.Subject, claims.SID, actor.Chain(), clientID, claims.Scope)
+
+	tokenType := "Bearer"
+	if client.Cnf != nil && client.Cnf.JKT != "" {
+		tokenType = "DPoP"
+	}
+
+	return &TokenExchangeResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenType,
+		ExpiresIn:       int64(time.Until(expiresAt).Seconds()),
+		Scope:           claims.Scope,
+	}, nil
+}
+
+// Validates a subject or actor token of a token exchange.
+func exchangedTokenClaims(db *gorm.DB, cfg *config.Config, token string, tokenType string) (*CustomClaims, error) {
+	if tokenType != TokenTypeAccessToken && tokenType != TokenTypeJWT {
+		return nil, ErrUnsupportedTokenType
+	}
+
+	claims, err := AuthenticateAccessToken(db, cfg, token)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	if _, err := CheckSessionExists(db, claims.SID); err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	return claims, nil
+}
+
+// Denylists the unexpired access tokens exchanged for the sessions.
+func denylistExchangedAccessTokens(db *gorm.DB, sessionIDs []string) error {
+	exchangedTokens, err := models.GetExchangedAccessTokens(db, sessionIDs)
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]time.Time, len(exchangedTokens))
+	for _, token := range exchangedTokens {
+		tokens[token.JTI] = token.ExpireAt
+	}
+	return RevokeAccessTokens(db, tokens)
+}
+
+// Denylists the unexpired access tokens exchanged for removed sessions and forgets them.
+// Called after the sessions are removed, so tokens exchanged concurrently are either found or refused.
+func revokeExchangedAccessTokens(db *gorm.DB, sessionIDs []string) error {
+	if err := denylistExchangedAccessTokens(db, sessionIDs); err != nil {
+		return err
+	}
+	return models.DeleteExchangedAccessTokens(db, sessionIDs)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"simpleAuth/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.TokenAudience = []string{"api", "billing"}
+	cfg.ActorUserIDs = []string{"orders-service"}
+
+	userTokens, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	serviceTokens, err := SignIn(db, cfg, UserInfo{UserID: "orders-service", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	userClaims, err := ValidateToken(cfg, userTokens.AccessToken)
+	assert.NoError(t, err)
+	session, err := models.GetSession(db, userClaims.SID)
+	assert.NoError(t, err)
+
+	response, err := ExchangeToken(db, cfg, &TokenExchangeRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     userTokens.AccessToken,
+		SubjectTokenType: TokenTypeAccessToken,
+		ActorToken:       serviceTokens.AccessToken,
+		ActorTokenType:   TokenTypeAccessToken,
+		Scope:            ScopeProfile,
+		Audience:         []string{"billing"},
+	}, "gateway", UserInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, TokenTypeAccessToken, response.IssuedTokenType)
+	assert.Equal(t, ScopeProfile, response.Scope)
+	assert.Positive(t, response.ExpiresIn)
+
+	claims, err := ValidateToken(cfg, response.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, []string{"billing"}, []string(claims.Audience))
+	assert.Equal(t, []string{"orders-service"}, claims.Act.Chain())
+
+	// The exchange is recorded apart from the session, which is not marked as used
+	exchangedSession, err := models.GetSession(db, userClaims.SID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.UpdatedAt, exchangedSession.UpdatedAt)
+	assert.Equal(t, session.AccessTokenIDs, exchangedSession.AccessTokenIDs)
+	exchangedTokens, err := models.GetExchangedAccessTokens(db, []string{userClaims.SID})
+	assert.NoError(t, err)
+	assert.Len(t, exchangedTokens, 1)
+
+	// Exchanging the delegated token again extends the actor chain
+	response, err = ExchangeToken(db, cfg, &TokenExchangeRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     response.AccessToken,
+		SubjectTokenType: TokenTypeAccessToken,
+	}, "gateway", UserInfo{})
+	assert.NoError(t, err)
+	claims, err = ValidateToken(cfg, response.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gateway", "orders-service"}, claims.Act.Chain())
+
+	// Exchanged tokens are revoked together with the session of the subject token
+	err = SignOut(db, claims.SID)
+	assert.NoError(t, err)
+	_, err = ValidateToken(cfg, response.AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+	exchangedTokens, err = models.GetExchangedAccessTokens(db, []string{userClaims.SID})
+	assert.NoError(t, err)
+	assert.Empty(t, exchangedTokens)
+}
+
+func TestExchangeTokenRejectsBroaderRequest(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent", Scopes: []string{ScopeProfile}})
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		request TokenExchangeRequest
+		err     error
+	}{
+		{TokenExchangeRequest{SubjectToken: tokenPair.AccessToken, SubjectTokenType: TokenTypeAccessToken, Scope: ScopeSessionsWrite}, ErrInvalidScope},
+		{TokenExchangeRequest{SubjectToken: tokenPair.AccessToken, SubjectTokenType: TokenTypeAccessToken, Audience: []string{"other"}}, ErrInvalidTarget},
+		{TokenExchangeRequest{SubjectToken: tokenPair.AccessToken, SubjectTokenType: "urn:ietf:params:oauth:token-type:saml2"}, ErrUnsupportedTokenType},
+		{TokenExchangeRequest{SubjectToken: tokenPair.RefreshToken, SubjectTokenType: TokenTypeAccessToken}, ErrInvalidGrant},
+		{TokenExchangeRequest{SubjectToken: tokenPair.AccessToken, SubjectTokenType: TokenTypeAccessToken, ActorToken: "invalid", ActorTokenType: TokenTypeAccessToken}, ErrInvalidGrant},
+	} {
+		test.request.GrantType = GrantTypeTokenExchange
+		_, err := ExchangeToken(db, cfg, &test.request, "gateway", UserInfo{})
+		assert.Equal(t, test.err, err)
+	}
+}
+
+func TestExchangeTokenRequiresProofForBoundSubjectToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	cnf := &Confirmation{X5TS256: CertificateThumbprint([]byte("client certificate"))}
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent", Cnf: cnf})
+	assert.NoError(t, err)
+
+	request := &TokenExchangeRequest{GrantType: GrantTypeTokenExchange, SubjectToken: tokenPair.AccessToken, SubjectTokenType: TokenTypeAccessToken}
+	_, err = ExchangeToken(db, cfg, request, "gateway", UserInfo{})
+	assert.Equal(t, ErrInvalidGrant, err)
+
+	response, err := ExchangeToken(db, cfg, request, "gateway", UserInfo{Cnf: cnf})
+	assert.NoError(t, err)
+	claims, err := ValidateToken(cfg, response.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, cnf.X5TS256, claims.Cnf.X5TS256)
+}
+
+func TestExchangeTokenRequiresProofForBoundActorToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.ActorUserIDs = []string{"orders-service"}
+
+	userTokens, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	cnf := &Confirmation{X5TS256: CertificateThumbprint([]byte("service certificate"))}
+	serviceTokens, err := SignIn(db, cfg, UserInfo{UserID: "orders-service", UserIP: "127.0.0.1", UserAgent: "test-agent", Cnf: cnf})
+	assert.NoError(t, err)
+
+	request := &TokenExchangeRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     userTokens.AccessToken,
+		SubjectTokenType: TokenTypeAccessToken,
+		ActorToken:       serviceTokens.AccessToken,
+		ActorTokenType:   TokenTypeAccessToken,
+	}
+	_, err = ExchangeToken(db, cfg, request, "gateway", UserInfo{})
+	assert.Equal(t, ErrInvalidGrant, err)
+
+	_, err = ExchangeToken(db, cfg, request, "gateway", UserInfo{Cnf: &Confirmation{X5TS256: CertificateThumbprint([]byte("other certificate"))}})
+	assert.Equal(t, ErrInvalidGrant, err)
+
+	response, err := ExchangeToken(db, cfg, request, "gateway", UserInfo{Cnf: cnf})
+	assert.NoError(t, err)
+	claims, err := ValidateToken(cfg, response.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders-service"}, claims.Act.Chain())
+}
+
+func TestExchangeTokenRequiresActorRole(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.ActorUserIDs = []string{"orders-service"}
+
+	userTokens, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	otherUserTokens, err := SignIn(db, cfg, UserInfo{UserID: "other-user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	serviceTokens, err := SignIn(db, cfg, UserInfo{UserID: "orders-service", UserIP: "127.0.0.1", UserAgent: "test-agent", Scopes: []string{ScopeProfile}})
+	assert.NoError(t, err)
+
+	request := &TokenExchangeRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     userTokens.AccessToken,
+		SubjectTokenType: TokenTypeAccessToken,
+		ActorTokenType:   TokenTypeAccessToken,
+	}
+
+	// A user without the actor role cannot act on behalf of another user
+	request.ActorToken = otherUserTokens.AccessToken
+	_, err = ExchangeToken(db, cfg, request, "gateway", UserInfo{})
+	assert.Equal(t, ErrInvalidActor, err)
+
+	// The actor role is not enough when the actor token was issued without the scope
+	request.ActorToken = serviceTokens.AccessToken
+	_, err = ExchangeToken(db, cfg, request, "gateway", UserInfo{})
+	assert.Equal(t, ErrInvalidActor, err)
+}
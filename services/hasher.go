@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"simpleAuth/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported refresh token hash algorithms
+const (
+	HashAlgorithmBcrypt     = "bcrypt"
+	HashAlgorithmArgon2id   = "argon2id"
+	HashAlgorithmHMACSHA256 = "hmac-sha256"
+)
+
+// Hashes refresh token secrets for storage in the session.
+// Every hash carries an algorithm prefix in the modular crypt format, so stored hashes of different algorithms can coexist.
+type RefreshTokenHasher interface {
+	Hash(secret string) (string, error)
+	Compare(hashedSecret string, secret string) bool
+	Owns(hashedSecret string) bool // Reports whether the hash was produced by this algorithm
+}
+
+// Returns the hasher configured for new refresh tokens.
+func NewRefreshTokenHasher(cfg *config.Config) (RefreshTokenHasher, error) {
+	switch cfg.RefreshTokenHashAlgorithm {
+	case HashAlgorithmBcrypt:
+		return bcryptHasher{}, nil
+	case HashAlgorithmArgon2id:
+		return argon2idHasher{}, nil
+	case HashAlgorithmHMACSHA256:
+		if cfg.RefreshTokenHashKey == "" {
+			return nil, fmt.Errorf("refresh token hash key is required for %s", HashAlgorithmHMACSHA256)
+		}
+		return hmacHasher{key: []byte(cfg.RefreshTokenHashKey)}, nil
+	}
+	return nil, fmt.Errorf("unsupported refresh token hash algorithm: %s", cfg.RefreshTokenHashAlgorithm)
+}
+
+// Returns the hasher that produced the stored hash.
+func refreshTokenHasherFor(cfg *config.Config, hashedSecret string) (RefreshTokenHasher, error) {
+	hashers := []RefreshTokenHasher{bcryptHasher{}, argon2idHasher{}, hmacHasher{key: []byte(cfg.RefreshTokenHashKey)}}
+	for _, hasher := range hashers {
+		if hasher.Owns(hashedSecret) {
+			return hasher, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown refresh token hash algorithm")
+}
+
+// bcrypt at the default cost, the original format of stored refresh tokens.
+type bcryptHasher struct{}
+
+func (bcryptHasher) Hash(secret string) (string, error) {
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedSecret), nil
+}
+
+func (bcryptHasher) Compare(hashedSecret string, secret string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashedSecret), []byte(secret)) == nil
+}
+
+func (bcryptHasher) Owns(hashedSecret string) bool {
+	return strings.HasPrefix(hashedSecret, "$2")
+}
+
+// argon2id with the OWASP recommended minimum parameters, encoded in the PHC string format.
+type argon2idHasher struct{}
+
+const (
+	argon2idTime    = 2
+	argon2idMemory  = 19 * 1024
+	argon2idThreads = 1
+	argon2idKeyLen  = 32
+)
+
+func (argon2idHasher) Hash(secret string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(secret), salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2idMemory, argon2idTime, argon2idThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (argon2idHasher) Compare(hashedSecret string, secret string) bool {
+	parts := strings.Split(hashedSecret, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	expectedKey, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(expectedKey)))
+	return subtle.ConstantTimeCompare(key, expectedKey) == 1
+}
+
+func (argon2idHasher) Owns(hashedSecret string) bool {
+	return strings.HasPrefix(hashedSecret, "$argon2id$")
+}
+
+// Keyed HMAC-SHA256. Refresh token secrets are 256 bits of randomness, so a slow password hash adds no security,
+// the key protects the stored hashes if the database leaks.
+type hmacHasher struct {
+	key []byte
+}
+
+const hmacSHA256Prefix = "$hmac-sha256$"
+
+func (h hmacHasher) Hash(secret string) (string, error) {
+	return hmacSHA256Prefix + base64.RawStdEncoding.EncodeToString(h.sum(secret)), nil
+}
+
+func (h hmacHasher) Compare(hashedSecret string, secret string) bool {
+	expectedSum, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(hashedSecret, hmacSHA256Prefix))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(h.sum(secret), expectedSum)
+}
+
+func (h hmacHasher) Owns(hashedSecret string) bool {
+	return strings.HasPrefix(hashedSecret, hmacSHA256Prefix)
+}
+
+func (h hmacHasher) sum(secret string) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(secret))
+	return mac.Sum(nil)
+}
+
+// Returns the SHA-256 fingerprint of a superseded refresh token, stored to detect its reuse.
+// Unlike the stored hash of the current token it is looked up directly, so checking a
+// presented token costs one query regardless of how many tokens the session superseded.
+func refreshTokenFingerprint(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTokenHashers(t *testing.T) {
+	for _, algorithm := range []string{HashAlgorithmBcrypt, HashAlgorithmArgon2id, HashAlgorithmHMACSHA256} {
+		cfg := &config.Config{RefreshTokenHashAlgorithm: algorithm, RefreshTokenHashKey: "test-key"}
+
+		hashedToken, err := HashRefreshToken(cfg, "test-refresh-token")
+		assert.NoError(t, err)
+		assert.True(t, CompareRefreshToken(cfg, hashedToken, "test-refresh-token"), algorithm)
+		assert.False(t, CompareRefreshToken(cfg, hashedToken, "other-refresh-token"), algorithm)
+	}
+}
+
+func TestCompareRefreshTokenAcrossAlgorithms(t *testing.T) {
+	bcryptCfg := &config.Config{RefreshTokenHashAlgorithm: HashAlgorithmBcrypt, RefreshTokenHashKey: "test-key"}
+	hmacCfg := &config.Config{RefreshTokenHashAlgorithm: HashAlgorithmHMACSHA256, RefreshTokenHashKey: "test-key"}
+
+	hashedToken, err := HashRefreshToken(bcryptCfg, "test-refresh-token")
+	assert.NoError(t, err)
+	assert.True(t, CompareRefreshToken(hmacCfg, hashedToken, "test-refresh-token"))
+
+	hashedToken, err = HashRefreshToken(hmacCfg, "test-refresh-token")
+	assert.NoError(t, err)
+	assert.Contains(t, hashedToken, "$hmac-sha256$")
+
+	otherKeyCfg := &config.Config{RefreshTokenHashAlgorithm: HashAlgorithmHMACSHA256, RefreshTokenHashKey: "other-key"}
+	assert.False(t, CompareRefreshToken(otherKeyCfg, hashedToken, "test-refresh-token"))
+}
+
+func TestNewRefreshTokenHasherRequiresHMACKey(t *testing.T) {
+	_, err := NewRefreshTokenHasher(&config.Config{RefreshTokenHashAlgorithm: HashAlgorithmHMACSHA256})
+	assert.Error(t, err)
+
+	_, err = NewRefreshTokenHasher(&config.Config{RefreshTokenHashAlgorithm: "md5"})
+	assert.Error(t, err)
+}
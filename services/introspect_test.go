@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	response := IntrospectToken(db, cfg, tokenPair.AccessToken, "")
+	assert.True(t, response.Active)
+	assert.Equal(t, "user", response.Sub)
+	assert.Equal(t, cfg.TokenIssuer, response.Iss)
+	assert.NotEmpty(t, response.SID)
+	assert.NotEmpty(t, response.Jti)
+	assert.NotZero(t, response.Exp)
+	assert.Contains(t, response.Scope, ScopeProfile)
+
+	err = SignOut(db, response.SID)
+	assert.NoError(t, err)
+
+	response = IntrospectToken(db, cfg, tokenPair.AccessToken, "")
+	assert.Equal(t, &IntrospectionResponse{Active: false}, response)
+
+	response = IntrospectToken(db, cfg, "not-a-token", "")
+	assert.False(t, response.Active)
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	response := IntrospectToken(db, cfg, tokenPair.RefreshToken, "")
+	assert.True(t, response.Active)
+	assert.Equal(t, "refresh_token", response.TokenType)
+	assert.Equal(t, "user", response.Sub)
+	assert.NotZero(t, response.Exp)
+
+	// Legacy refresh tokens are found through the access token issued with them
+	cfg.AcceptLegacyRefreshTokens = true
+	sessionID, accessToken, legacyRefreshToken := createLegacySession(t, db, cfg)
+	assert.False(t, IntrospectToken(db, cfg, legacyRefreshToken, "").Active)
+
+	response = IntrospectToken(db, cfg, legacyRefreshToken, accessToken)
+	assert.True(t, response.Active)
+	assert.Equal(t, "refresh_token", response.TokenType)
+	assert.Equal(t, sessionID, response.SID)
+
+	assert.False(t, IntrospectToken(db, cfg, "bm90LXRoZS1yZWZyZXNoLXRva2Vu", accessToken).Active)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"simpleAuth/config"
+	"strings"
+)
+
+// Content encryption algorithm of encrypted access tokens
+const jweEncryptionA256GCM = "A256GCM"
+
+// Protected header of encrypted access tokens (RFC 7516 section 4)
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	ContentType string `json:"cty,omitempty"`
+	KeyID       string `json:"kid,omitempty"`
+}
+
+// Checks whether the token is in the JWE compact serialization, which has five parts.
+func isEncryptedToken(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Encrypts the signed token into a nested JWT in the JWE compact serialization.
+func encryptToken(key *config.EncryptionKey, signedToken string) (string, error) {
+	header, err := json.Marshal(jweHeader{
+		Algorithm:   key.Algorithm,
+		Encryption:  jweEncryptionA256GCM,
+		ContentType: "JWT",
+		KeyID:       key.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+
+	contentKey := key.Secret
+	var encryptedKey []byte
+	if key.Algorithm == config.EncryptionAlgorithmRSAOAEP256 {
+		contentKey = make([]byte, 32)
+		if _, err := rand.Read(contentKey); err != nil {
+			return "", err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key.PublicKey, contentKey, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	gcm, err := newA256GCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	// The additional authenticated data is the encoded protected header
+	sealed := gcm.Seal(nil, iv, []byte(signedToken), []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypts a nested JWT and returns the signed token inside, which still has to be verified.
+// Only the configured key management algorithm is accepted.
+func decryptToken(key *config.EncryptionKey, token string) (string, error) {
+	if key == nil || !key.CanDecrypt() {
+		return "", fmt.Errorf("no key to decrypt the token")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("invalid encrypted token")
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return "", fmt.Errorf("invalid encrypted token")
+		}
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return "", fmt.Errorf("invalid encrypted token header: %v", err)
+	}
+	if header.Algorithm != key.Algorithm || header.Encryption != jweEncryptionA256GCM {
+		return "", fmt.Errorf("unexpected encryption algorithm: %s %s", header.Algorithm, header.Encryption)
+	}
+
+	contentKey := key.Secret
+	if key.Algorithm == config.EncryptionAlgorithmRSAOAEP256 {
+		var err error
+		contentKey, err = rsa.DecryptOAEP(sha256.New(), nil, key.PrivateKey, decoded[1], nil)
+		if err != nil {
+			return "", fmt.Errorf("failed decrypt content key")
+		}
+	} else if len(decoded[1]) != 0 {
+		return "", fmt.Errorf("unexpected encrypted key for direct encryption")
+	}
+
+	gcm, err := newA256GCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+	if len(decoded[2]) != gcm.NonceSize() || len(decoded[4]) != gcm.Overhead() {
+		return "", fmt.Errorf("invalid encrypted token")
+	}
+
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("failed decrypt token")
+	}
+
+	return string(plaintext), nil
+}
+
+func newA256GCM(contentKey []byte) (cipher.AEAD, error) {
+	if len(contentKey) != 32 {
+		return nil, fmt.Errorf("invalid content encryption key")
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
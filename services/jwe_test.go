@@ -0,0 +1,80 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"simpleAuth/config"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedAccessTokens(t *testing.T) {
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	assert.NoError(t, err)
+
+	for _, key := range []*config.EncryptionKey{
+		{Algorithm: config.EncryptionAlgorithmRSAOAEP256, ID: "resource-servers", PublicKey: &encryptionKey.PublicKey, PrivateKey: encryptionKey},
+		{Algorithm: config.EncryptionAlgorithmDir, Secret: secret},
+	} {
+		cfg := setupTestConfig(t)
+		plainToken, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+		assert.NoError(t, err)
+
+		cfg.EncryptionKey = key
+		tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session", Scope: ScopeProfile})
+		assert.NoError(t, err)
+		assert.True(t, isEncryptedToken(tokenString))
+
+		// The claims are not readable without the key
+		encodedHeader, _, _ := strings.Cut(tokenString, ".")
+		headerJSON, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+		assert.NoError(t, err)
+		var header jweHeader
+		assert.NoError(t, json.Unmarshal(headerJSON, &header))
+		assert.Equal(t, key.Algorithm, header.Algorithm)
+		assert.Equal(t, "A256GCM", header.Encryption)
+		assert.Equal(t, "JWT", header.ContentType)
+		assert.NotContains(t, tokenString, base64.RawURLEncoding.EncodeToString([]byte(`"sub":"user"`)))
+
+		claims, err := ValidateToken(cfg, tokenString)
+		assert.NoError(t, err)
+		assert.Equal(t, "user", claims.Subject)
+		assert.Equal(t, ScopeProfile, claims.Scope)
+
+		// Signed tokens issued before enabling encryption stay valid
+		_, err = ValidateToken(cfg, plainToken)
+		assert.NoError(t, err)
+
+		// Any change of the ciphertext fails authentication
+		parts := strings.Split(tokenString, ".")
+		ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+		assert.NoError(t, err)
+		ciphertext[0] ^= 1
+		parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+		_, err = ValidateToken(cfg, strings.Join(parts, "."))
+		assert.Error(t, err)
+	}
+}
+
+func TestEncryptedAccessTokenRequiresDecryptionKey(t *testing.T) {
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	cfg := setupTestConfig(t)
+	cfg.EncryptionKey = &config.EncryptionKey{Algorithm: config.EncryptionAlgorithmRSAOAEP256, PublicKey: &encryptionKey.PublicKey, PrivateKey: encryptionKey}
+
+	tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+
+	// A replica with encryption disabled rejects encrypted tokens instead of treating them as signed ones
+	cfg.EncryptionKey = nil
+	_, err = ValidateToken(cfg, tokenString)
+	assert.EqualError(t, err, "no key to decrypt the token")
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"simpleAuth/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JSON Web Key (RFC 7517) describing a public key used to verify access tokens
+type JWK struct {
+	Kty string `json:"kty"`           // Key type
+	Use string `json:"use"`           // Public key use
+	Alg string `json:"alg"`           // Signing algorithm
+	Kid string `json:"kid"`           // Key ID
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	Crv string `json:"crv,omitempty"` // Curve of EC and OKP keys
+	X   string `json:"x,omitempty"`   // X coordinate of EC keys, public key of OKP keys
+	Y   string `json:"y,omitempty"`   // Y coordinate of EC keys
+}
+
+// JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Builds the JSON Web Key Set with the keys accepted for access token verification.
+func GetJWKS(cfg *config.Config) JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range cfg.Keys.VerificationKeys() {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed serialize key %s", key.ID)
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// Serializes the public part of the key as a JWK.
+func NewJWK(key *config.Key) (JWK, error) {
+	params, err := config.JWKParams(key.PublicKey)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	return JWK{
+		Kty: params["kty"],
+		Use: "sig",
+		Alg: key.Algorithm,
+		Kid: key.ID,
+		N:   params["n"],
+		E:   params["e"],
+		Crv: params["crv"],
+		X:   params["x"],
+		Y:   params["y"],
+	}, nil
+}
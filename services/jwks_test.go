@@ -0,0 +1,48 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJWK(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwk, err := NewJWK(&config.Key{ID: "test-kid", Algorithm: config.AlgorithmRS512, PublicKey: &privateKey.PublicKey})
+	assert.NoError(t, err)
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, "RS512", jwk.Alg)
+	assert.Equal(t, "test-kid", jwk.Kid)
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	assert.NoError(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	assert.NoError(t, err)
+
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	assert.True(t, publicKey.Equal(&privateKey.PublicKey))
+}
+
+func TestNewJWKEC(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jwk, err := NewJWK(&config.Key{ID: "test-kid", Algorithm: config.AlgorithmES256, PublicKey: &privateKey.PublicKey})
+	assert.NoError(t, err)
+	assert.Equal(t, "EC", jwk.Kty)
+	assert.Equal(t, "P-256", jwk.Crv)
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	assert.NoError(t, err)
+	assert.Len(t, x, 32)
+	assert.Equal(t, privateKey.X, new(big.Int).SetBytes(x))
+}
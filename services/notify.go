@@ -5,11 +5,24 @@ import (
 	"encoding/json"
 	"net/http"
 	"simpleAuth/config"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Notification events
+const (
+	EventIPChanged         = "ip_changed"          // Session refreshed from a new IP
+	EventRefreshTokenReuse = "refresh_token_reuse" // Superseded refresh token replayed, session revoked
+	EventSessionRevoked    = "session_revoked"     // Session revoked by its user from another or the same session
+	EventSessionEvicted    = "session_evicted"     // Least recently used session revoked by a sign-in at the session limit
+)
+
+// Webhook client, a hanging webhook must not hold up the requests sending notifications
+var notificationClient = &http.Client{Timeout: 5 * time.Second}
+
 type NotificationPayload struct {
+	Event     string `json:"event"`
 	UserID    string `json:"user_id"`
 	SessionID string `json:"session_id"`
 	UserIP    string `json:"user_ip"`
@@ -23,10 +36,23 @@ func Notify(cfg *config.Config, payload NotificationPayload) {
 		return
 	}
 
-	resp, err := http.Post(cfg.WebhookURL, "application/json", bytes.NewBuffer(jsonPayload))
+	resp, err := notificationClient.Post(cfg.WebhookURL, "application/json", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		logrus.WithError(err).Error("Failed send notification")
 		return
 	}
 	defer resp.Body.Close()
 }
+
+// Sends notification payloads one by one in the background, so revoking many sessions does not wait for the webhook.
+func NotifyAll(cfg *config.Config, payloads []NotificationPayload) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	go func() {
+		for _, payload := range payloads {
+			Notify(cfg, payload)
+		}
+	}()
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Creates a random opaque access token encoded in base64.
+func generateOpaqueAccessToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// Hashes the opaque access token for lookup.
+// A fast unsalted hash is sufficient, the token is 256 bits of randomness.
+func hashOpaqueAccessToken(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checks whether the access token is opaque, JWT and PASETO tokens always contain dots.
+func isOpaqueAccessToken(accessToken string) bool {
+	return accessToken != "" && !strings.Contains(accessToken, ".")
+}
+
+// Resolves an opaque access token to the claims of the session it was issued for.
+// Only the latest access token of the session is valid, so refreshing or deleting the session revokes it at once.
+func GetOpaqueTokenPayload(db *gorm.DB, cfg *config.Config, accessToken string) (*CustomClaims, error) {
+	session, err := models.GetSessionByAccessToken(db, hashOpaqueAccessToken(accessToken))
+	if err != nil {
+		return nil, fmt.Errorf("unknown access token")
+	}
+	if time.Now().After(session.AccessTokenExpireAt) {
+		return nil, fmt.Errorf("token has expired")
+	}
+
+	claims := sessionClaims(session)
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    cfg.TokenIssuer,
+		Audience:  cfg.TokenAudience,
+		IssuedAt:  jwt.NewNumericDate(session.AccessTokenExpireAt.Add(-time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(session.AccessTokenExpireAt),
+	}
+
+	return &claims, nil
+}
+
+// Checks the access token of either format and returns its claims.
+// Self-contained tokens are accepted in the opaque mode as well, so switching formats does not sign out users.
+func AuthenticateAccessToken(db *gorm.DB, cfg *config.Config, accessToken string) (*CustomClaims, error) {
+	if isOpaqueAccessToken(accessToken) {
+		return GetOpaqueTokenPayload(db, cfg, accessToken)
+	}
+	return ValidateToken(cfg, accessToken)
+}
+
+// Issues an access token for the session in the configured format and records it in the session.
+func issueAccessToken(cfg *config.Config, session *models.Session) (string, error) {
+	if cfg.AccessTokenFormat == config.AccessTokenFormatOpaque {
+		accessToken, err := generateOpaqueAccessToken()
+		if err != nil {
+			return "", err
+		}
+
+		session.AccessTokenHash = hashOpaqueAccessToken(accessToken)
+		session.AccessTokenExpireAt = time.Now().Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)
+		return accessToken, nil
+	}
+
+	claims := sessionClaims(session)
+	accessToken, err := GenerateAccessToken(cfg, &claims)
+	if err != nil {
+		return "", err
+	}
+	session.AccessTokenIDs = trackAccessToken(session.AccessTokenIDs, &claims)
+
+	return accessToken, nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpaqueAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.AccessTokenFormat = config.AccessTokenFormatOpaque
+
+	client := UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"}
+	tokenPair, err := SignIn(db, cfg, client)
+	assert.NoError(t, err)
+	assert.True(t, isOpaqueAccessToken(tokenPair.AccessToken))
+
+	claims, err := AuthenticateAccessToken(db, cfg, tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Contains(t, claims.Scope, ScopeProfile)
+
+	response := IntrospectToken(db, cfg, tokenPair.AccessToken, "")
+	assert.True(t, response.Active)
+	assert.Equal(t, claims.SID, response.SID)
+
+	// Refreshing replaces the stored hash, the previous access token stops working at once
+	newTokenPair, err := RefreshToken(db, cfg, &RefreshTokenRequest{RefreshToken: tokenPair.RefreshToken}, client)
+	assert.NoError(t, err)
+	_, err = AuthenticateAccessToken(db, cfg, tokenPair.AccessToken)
+	assert.Error(t, err)
+	_, err = AuthenticateAccessToken(db, cfg, newTokenPair.AccessToken)
+	assert.NoError(t, err)
+
+	err = RevokeToken(db, cfg, newTokenPair.AccessToken, "")
+	assert.NoError(t, err)
+	_, err = AuthenticateAccessToken(db, cfg, newTokenPair.AccessToken)
+	assert.Error(t, err)
+	_, err = CheckSessionExists(db, claims.SID)
+	assert.Error(t, err)
+}
+
+func TestAuthenticateAccessTokenAcceptsJWTInOpaqueMode(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+
+	cfg.AccessTokenFormat = config.AccessTokenFormatOpaque
+	claims, err := AuthenticateAccessToken(db, cfg, tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"simpleAuth/config"
+	"strings"
+	"time"
+)
+
+// Header of PASETO v4 public tokens
+const pasetoV4PublicHeader = "v4.public."
+
+// PASETO v4.public access tokens: Ed25519 signatures over the pre-authentication encoding
+// of the header, JSON payload and footer. There is no algorithm in the token to confuse.
+type pasetoFormat struct{}
+
+// Footer of issued PASETO tokens, identifying the verification key
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// Time based PASETO claims, encoded as RFC 3339 strings instead of numeric dates
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+func (pasetoFormat) Encode(key *config.Key, claims *CustomClaims) (string, error) {
+	if _, ok := key.PublicKey.(ed25519.PublicKey); !ok {
+		return "", fmt.Errorf("PASETO v4.public requires an Ed25519 signing key")
+	}
+
+	payload, err := encodePASETOClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	footer, err := json.Marshal(pasetoFooter{KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	return signPASETO(key.PrivateKey, payload, footer)
+}
+
+func (pasetoFormat) Decode(keys *config.KeyRing, token string) (*CustomClaims, error) {
+	payload, err := verifyPASETO(token, func(footer []byte) (ed25519.PublicKey, error) {
+		key := keys.SigningKey()
+		if len(footer) > 0 {
+			var decodedFooter pasetoFooter
+			if err := json.Unmarshal(footer, &decodedFooter); err != nil {
+				return nil, fmt.Errorf("invalid PASETO footer: %v", err)
+			}
+			var err error
+			if key, err = keys.VerificationKey(decodedFooter.KeyID); err != nil {
+				return nil, err
+			}
+		}
+
+		publicKey, ok := key.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("PASETO v4.public requires an Ed25519 verification key")
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePASETOClaims(payload)
+}
+
+// Signs the payload and footer into a v4.public token.
+func signPASETO(signer crypto.Signer, payload []byte, footer []byte) (string, error) {
+	signature, err := signer.Sign(rand.Reader, pasetoPAE([]byte(pasetoV4PublicHeader), payload, footer, nil), crypto.Hash(0))
+	if err != nil {
+		return "", err
+	}
+
+	token := pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(append(payload, signature...))
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token, nil
+}
+
+// Verifies a v4.public token with the key selected by its footer and returns the payload.
+func verifyPASETO(token string, keyFunc func(footer []byte) (ed25519.PublicKey, error)) ([]byte, error) {
+	payload, signature, footer, err := splitPASETO(token)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := keyFunc(footer)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ed25519.Verify(publicKey, pasetoPAE([]byte(pasetoV4PublicHeader), payload, footer, nil), signature) {
+		return nil, fmt.Errorf("invalid PASETO signature")
+	}
+
+	return payload, nil
+}
+
+// Splits a v4.public token into the payload, signature and footer.
+func splitPASETO(token string) (payload []byte, signature []byte, footer []byte, err error) {
+	body, ok := strings.CutPrefix(token, pasetoV4PublicHeader)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("not a PASETO v4.public token")
+	}
+
+	encodedMessage, encodedFooter, _ := strings.Cut(body, ".")
+	message, err := base64.RawURLEncoding.DecodeString(encodedMessage)
+	if err != nil || len(message) < ed25519.SignatureSize {
+		return nil, nil, nil, fmt.Errorf("invalid PASETO payload")
+	}
+	footer, err = base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid PASETO footer")
+	}
+
+	return message[:len(message)-ed25519.SignatureSize], message[len(message)-ed25519.SignatureSize:], footer, nil
+}
+
+// Pre-authentication encoding of the pieces (PASETO specification, section "PAE").
+func pasetoPAE(pieces ...[]byte) []byte {
+	encoded := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		encoded = binary.LittleEndian.AppendUint64(encoded, uint64(len(piece)))
+		encoded = append(encoded, piece...)
+	}
+	return encoded
+}
+
+// Encodes the claims as a PASETO payload, converting the time based claims to RFC 3339.
+func encodePASETOClaims(claims *CustomClaims) ([]byte, error) {
+	payload, err := claimsMap(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range pasetoTimeClaims {
+		if seconds, ok := payload[name].(float64); ok {
+			payload[name] = time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+		}
+	}
+	// PASETO defines the audience as a single string
+	if audience, ok := payload["aud"].([]any); ok && len(audience) == 1 {
+		payload["aud"] = audience[0]
+	}
+
+	return json.Marshal(payload)
+}
+
+// Decodes a PASETO payload into claims, converting the RFC 3339 time based claims to numeric dates.
+func decodePASETOClaims(payload []byte) (*CustomClaims, error) {
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid PASETO claims: %v", err)
+	}
+
+	for _, name := range pasetoTimeClaims {
+		value, ok := claims[name].(string)
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PASETO %s claim: %v", name, err)
+		}
+		claims[name] = parsed.Unix()
+	}
+
+	converted, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var customClaims CustomClaims
+	if err := json.Unmarshal(converted, &customClaims); err != nil {
+		return nil, fmt.Errorf("invalid PASETO claims: %v", err)
+	}
+	return &customClaims, nil
+}
+
+// Converts the claims to their generic JSON representation.
+func claimsMap(claims *CustomClaims) (map[string]any, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]any
+	err = json.Unmarshal(encoded, &result)
+	return result, err
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"simpleAuth/config"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vector 4-S-1 of the PASETO specification
+func TestPASETOTestVector(t *testing.T) {
+	seed, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774")
+	assert.NoError(t, err)
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	payload := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	expected := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9" +
+		"bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	token, err := signPASETO(privateKey, payload, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, token)
+
+	verified, err := verifyPASETO(token, func([]byte) (ed25519.PublicKey, error) {
+		return privateKey.Public().(ed25519.PublicKey), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, payload, verified)
+}
+
+func TestPASETOAccessTokens(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	cfg := setupTestConfigWithKey(t, config.AlgorithmEdDSA, edKey)
+
+	jwtToken, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.NoError(t, err)
+
+	cfg.AccessTokenFormat = config.AccessTokenFormatPASETO
+	tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session", Scope: ScopeProfile})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tokenString, "v4.public."))
+
+	claims, err := ValidateToken(cfg, tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "session", claims.SID)
+	assert.Equal(t, ScopeProfile, claims.Scope)
+	assert.Equal(t, cfg.TokenIssuer, claims.Issuer)
+	assert.NotNil(t, claims.ExpiresAt)
+
+	// Tokens issued before switching the format stay valid
+	_, err = ValidateToken(cfg, jwtToken)
+	assert.NoError(t, err)
+
+	// Any change of the payload invalidates the signature
+	tampered := tokenString[:12] + string(tokenString[12]^1) + tokenString[13:]
+	_, err = ValidateToken(cfg, tampered)
+	assert.Error(t, err)
+}
+
+func TestPASETORequiresEd25519Key(t *testing.T) {
+	cfg := setupTestConfig(t)
+	cfg.AccessTokenFormat = config.AccessTokenFormatPASETO
+
+	_, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+	assert.EqualError(t, err, "PASETO v4.public requires an Ed25519 signing key")
+}
+
+func TestPASETOTimeClaims(t *testing.T) {
+	claims := &CustomClaims{Subject: "user"}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Unix(1700000000, 0))
+	claims.Audience = jwt.ClaimStrings{"api"}
+
+	payload, err := encodePASETOClaims(claims)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"exp":"2023-11-14T22:13:20Z"`)
+	assert.Contains(t, string(payload), `"aud":"api"`)
+
+	decoded, err := decodePASETOClaims(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, claims.ExpiresAt.Unix(), decoded.ExpiresAt.Unix())
+	assert.Equal(t, claims.Audience, decoded.Audience)
+}
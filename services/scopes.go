@@ -0,0 +1,69 @@
+package services
+
+import (
+	"simpleAuth/config"
+	"slices"
+	"strings"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	RoleActor = "actor" // Services acting on behalf of users
+)
+
+// Access token scopes
+const (
+	ScopeProfile       = "profile"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopeAdmin         = "admin"
+	ScopeTokenExchange = "token:exchange" // Act on behalf of users with the actor token in token exchange
+)
+
+// Scopes that can be granted to each role
+var roleScopes = map[string][]string{
+	RoleUser:  {ScopeProfile, ScopeSessionsRead, ScopeSessionsWrite},
+	RoleAdmin: {ScopeAdmin},
+	RoleActor: {ScopeTokenExchange},
+}
+
+// Returns the roles of the user and the scopes granted at sign-in.
+// Requested scopes are narrowed down to the ones allowed by the roles, all allowed scopes are granted when none are requested.
+func GrantScopes(cfg *config.Config, userID string, requestedScopes []string) ([]string, []string) {
+	roles := []string{RoleUser}
+	if slices.Contains(cfg.AdminUserIDs, userID) {
+		roles = append(roles, RoleAdmin)
+	}
+	if slices.Contains(cfg.ActorUserIDs, userID) {
+		roles = append(roles, RoleActor)
+	}
+
+	var allowedScopes []string
+	for _, role := range roles {
+		allowedScopes = append(allowedScopes, roleScopes[role]...)
+	}
+
+	if len(requestedScopes) == 0 {
+		return roles, allowedScopes
+	}
+
+	var scopes []string
+	for _, scope := range requestedScopes {
+		if slices.Contains(allowedScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return roles, scopes
+}
+
+// Splits a space-delimited scope string (RFC 6749 section 3.3).
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// Joins scopes into a space-delimited scope string.
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"simpleAuth/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantScopes(t *testing.T) {
+	cfg := &config.Config{AdminUserIDs: []string{"admin-id"}, ActorUserIDs: []string{"service-id"}}
+
+	roles, scopes := GrantScopes(cfg, "user-id", nil)
+	assert.Equal(t, []string{RoleUser}, roles)
+	assert.Equal(t, []string{ScopeProfile, ScopeSessionsRead, ScopeSessionsWrite}, scopes)
+
+	roles, scopes = GrantScopes(cfg, "admin-id", nil)
+	assert.Equal(t, []string{RoleUser, RoleAdmin}, roles)
+	assert.Contains(t, scopes, ScopeAdmin)
+
+	roles, scopes = GrantScopes(cfg, "service-id", nil)
+	assert.Equal(t, []string{RoleUser, RoleActor}, roles)
+	assert.Contains(t, scopes, ScopeTokenExchange)
+
+	_, scopes = GrantScopes(cfg, "user-id", []string{ScopeSessionsRead, ScopeAdmin, "unknown"})
+	assert.Equal(t, []string{ScopeSessionsRead}, scopes)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Returns the expiration time of a refresh token issued now,
+// never later than the end of the absolute session lifetime.
+func sessionExpireAt(cfg *config.Config, createdAt time.Time, now time.Time) time.Time {
+	expireAt := now.Add(time.Duration(cfg.RefreshTokenExpireMinutes) * time.Minute)
+	if cfg.SessionMaxAgeMinutes > 0 {
+		maxExpireAt := createdAt.Add(time.Duration(cfg.SessionMaxAgeMinutes) * time.Minute)
+		if maxExpireAt.Before(expireAt) {
+			return maxExpireAt
+		}
+	}
+	return expireAt
+}
+
+// Checks the absolute lifetime of the session, measured from sign-in,
+// and the idle timeout, measured from the last sign-in or refresh.
+func checkSessionLifetime(cfg *config.Config, session *models.Session, now time.Time) error {
+	if cfg.SessionMaxAgeMinutes > 0 && now.After(session.CreatedAt.Add(time.Duration(cfg.SessionMaxAgeMinutes)*time.Minute)) {
+		return fmt.Errorf("session exceeded the maximum lifetime")
+	}
+	if cfg.SessionIdleTimeoutMinutes > 0 && now.After(session.UpdatedAt.Add(time.Duration(cfg.SessionIdleTimeoutMinutes)*time.Minute)) {
+		return fmt.Errorf("session exceeded the idle timeout")
+	}
+	return nil
+}
+
+// Returns the time since which sessions must have been used to be active, zero if there is no idle timeout.
+func sessionIdleSince(cfg *config.Config, now time.Time) time.Time {
+	if cfg.SessionIdleTimeoutMinutes <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-time.Duration(cfg.SessionIdleTimeoutMinutes) * time.Minute)
+}
+
+// Reports whether the session has not expired at now and was used after idleSince.
+func isActiveSession(session *models.Session, now time.Time, idleSince time.Time) bool {
+	return session.ExpireAt.After(now) && session.UpdatedAt.After(idleSince)
+}
+
+// Returns the limit of active sessions per user, applied when a new session is created.
+func sessionLimit(cfg *config.Config, now time.Time) models.SessionLimit {
+	return models.SessionLimit{
+		MaxSessions: int(cfg.MaxSessionsPerUser),
+		Evict:       cfg.SessionLimitPolicy != config.SessionLimitPolicyReject,
+		Now:         now,
+		IdleSince:   sessionIdleSince(cfg, now),
+	}
+}
+
+// Revokes the access tokens of sessions evicted by the session limit and notifies about them.
+// The sessions are already removed, failures are only logged so the sign-in succeeds.
+func revokeEvictedSessions(db *gorm.DB, cfg *config.Config, sessions []models.Session, userIP string) {
+	var notifications []NotificationPayload
+	for _, session := range sessions {
+		logrus.Infof("Session %s of user %s evicted by the session limit", session.SessionID, session.UserID)
+
+		if err := RevokeAccessTokens(db, parseAccessTokenIDs(session.AccessTokenIDs)); err != nil {
+			logrus.WithError(err).Errorf("Failed revoke access tokens of evicted session %s", session.SessionID)
+		}
+		if err := revokeExchangedAccessTokens(db, []string{session.SessionID}); err != nil {
+			logrus.WithError(err).Errorf("Failed revoke exchanged access tokens of evicted session %s", session.SessionID)
+		}
+
+		notifications = append(notifications, NotificationPayload{
+			Event:     EventSessionEvicted,
+			UserID:    session.UserID,
+			SessionID: session.SessionID,
+			UserIP:    userIP,
+		})
+	}
+	NotifyAll(cfg, notifications)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Default and maximum number of sessions per page
+const (
+	DefaultSessionPageSize = 20
+	MaxSessionPageSize     = 100
+)
+
+// Returned when the session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// Page of the session list, the first page of the default size if not set
+type SessionListRequest struct {
+	Page     int `form:"page"      binding:"omitempty,min=1"`
+	PageSize int `form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+// Session as shown to its user, without the token hashes
+type SessionInfo struct {
+	SessionID    string    `json:"session_id"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	Scope        string    `json:"scope"`
+	CreatedAt    time.Time `json:"created_at"`     // Sign-in time
+	LastActiveAt time.Time `json:"last_active_at"` // Time of the last sign-in or refresh
+	ExpireAt     time.Time `json:"expire_at"`
+	Current      bool      `json:"current"` // Session of the access token making the request
+}
+
+type SessionList struct {
+	Sessions []SessionInfo `json:"sessions"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int64         `json:"total"`
+}
+
+// Lists the active sessions of the user, the most recently used first.
+// Sessions past the idle timeout are not listed, they cannot be refreshed anymore.
+func ListSessions(db *gorm.DB, cfg *config.Config, userID string, currentSessionID string, request *SessionListRequest) (*SessionList, error) {
+	page, pageSize := max(request.Page, 1), request.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultSessionPageSize
+	}
+	pageSize = min(pageSize, MaxSessionPageSize)
+
+	now := time.Now()
+	sessions, total, err := models.GetUserSessions(db, userID, now, sessionIdleSince(cfg, now), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &SessionList{Sessions: []SessionInfo{}, Page: page, PageSize: pageSize, Total: total}
+	for _, session := range sessions {
+		list.Sessions = append(list.Sessions, SessionInfo{
+			SessionID:    session.SessionID,
+			IP:           session.IP,
+			UserAgent:    session.UserAgent,
+			Scope:        session.Scope,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.UpdatedAt,
+			ExpireAt:     session.ExpireAt,
+			Current:      session.SessionID == currentSessionID,
+		})
+	}
+
+	return list, nil
+}
+
+// Revokes a session of the user. Sessions of other users are reported as not found.
+func RevokeUserSession(db *gorm.DB, cfg *config.Config, userID string, sessionID string, userIP string) error {
+	session, err := models.GetSession(db, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	if err := RevokeSession(db, session); err != nil {
+		return err
+	}
+
+	Notify(cfg, sessionRevokedPayload(session, userIP))
+	return nil
+}
+
+// Revokes all sessions of the user, except the current session if keepCurrent is set,
+// and returns the number of revoked active sessions.
+func SignOutAll(db *gorm.DB, cfg *config.Config, userID string, currentSessionID string, keepCurrent bool, userIP string) (int, error) {
+	exceptSessionID := ""
+	if keepCurrent {
+		exceptSessionID = currentSessionID
+	}
+
+	sessions, err := models.GetAllUserSessions(db, userID, exceptSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	accessTokenIDs := make(map[string]time.Time)
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		for tokenID, expireAt := range parseAccessTokenIDs(session.AccessTokenIDs) {
+			accessTokenIDs[tokenID] = expireAt
+		}
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+
+	// The tokens are denylisted before the sessions are removed, so a failure leaves the sessions to be revoked again
+	if err := RevokeAccessTokens(db, accessTokenIDs); err != nil {
+		return 0, err
+	}
+	if err := denylistExchangedAccessTokens(db, sessionIDs); err != nil {
+		return 0, err
+	}
+	if err := models.DeleteSessions(db, sessionIDs); err != nil {
+		return 0, err
+	}
+	if err := revokeExchangedAccessTokens(db, sessionIDs); err != nil {
+		return 0, err
+	}
+
+	// Expired and idle sessions are removed as well, but only the active ones are reported
+	now := time.Now()
+	idleSince := sessionIdleSince(cfg, now)
+	var notifications []NotificationPayload
+	for _, session := range sessions {
+		if isActiveSession(&session, now, idleSince) {
+			notifications = append(notifications, sessionRevokedPayload(&session, userIP))
+		}
+	}
+	logrus.Infof("Revoked %d sessions of user %s from %s", len(notifications), userID, userIP)
+	NotifyAll(cfg, notifications)
+
+	return len(notifications), nil
+}
+
+// Builds the notification about a session revoked by its user from the given IP.
+func sessionRevokedPayload(session *models.Session, userIP string) NotificationPayload {
+	return NotificationPayload{
+		Event:     EventSessionRevoked,
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		UserIP:    userIP,
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"simpleAuth/config"
+	"simpleAuth/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSessions(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.SessionIdleTimeoutMinutes = 60
+
+	var sessionIDs []string
+	for _, userAgent := range []string{"laptop", "phone", "idle"} {
+		tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: userAgent})
+		assert.NoError(t, err)
+		sessionID, _ := parseRefreshToken(tokenPair.RefreshToken)
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	_, err := SignIn(db, cfg, UserInfo{UserID: "other", UserIP: "127.0.0.1", UserAgent: "laptop"})
+	assert.NoError(t, err)
+
+	for index, lastActive := range []time.Duration{-10 * time.Minute, -time.Minute, -2 * time.Hour} {
+		err = db.Model(&models.Session{}).Where("session_id = ?", sessionIDs[index]).UpdateColumn("updated_at", time.Now().Add(lastActive)).Error
+		assert.NoError(t, err)
+	}
+
+	list, err := ListSessions(db, cfg, "user", sessionIDs[0], &SessionListRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Equal(t, DefaultSessionPageSize, list.PageSize)
+	assert.Len(t, list.Sessions, 2)
+
+	// The most recently used session comes first, the session of the caller is marked
+	assert.Equal(t, "phone", list.Sessions[0].UserAgent)
+	assert.False(t, list.Sessions[0].Current)
+	assert.Equal(t, "laptop", list.Sessions[1].UserAgent)
+	assert.True(t, list.Sessions[1].Current)
+
+	list, err = ListSessions(db, cfg, "user", sessionIDs[0], &SessionListRequest{Page: 2, PageSize: 1})
+	assert.NoError(t, err)
+	assert.Len(t, list.Sessions, 1)
+	assert.Equal(t, sessionIDs[0], list.Sessions[0].SessionID)
+}
+
+func TestRevokeUserSession(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	notifications := setupTestWebhook(t, cfg)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "phone"})
+	assert.NoError(t, err)
+	sessionID, _ := parseRefreshToken(tokenPair.RefreshToken)
+
+	// Sessions of other users are not revealed
+	assert.Equal(t, ErrSessionNotFound, RevokeUserSession(db, cfg, "other", sessionID, "10.0.0.1"))
+	assert.Equal(t, ErrSessionNotFound, RevokeUserSession(db, cfg, "user", "unknown", "10.0.0.1"))
+
+	// Database failures are not reported as a missing session
+	assert.NoError(t, db.Migrator().RenameTable("sessions", "sessions_unavailable"))
+	err = RevokeUserSession(db, cfg, "user", sessionID, "10.0.0.1")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrSessionNotFound, err)
+	assert.NoError(t, db.Migrator().RenameTable("sessions_unavailable", "sessions"))
+
+	assert.NoError(t, RevokeUserSession(db, cfg, "user", sessionID, "10.0.0.1"))
+	_, err = ValidateToken(cfg, tokenPair.AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+
+	notification := <-notifications
+	assert.Equal(t, EventSessionRevoked, notification.Event)
+	assert.Equal(t, sessionID, notification.SessionID)
+	assert.Equal(t, "10.0.0.1", notification.UserIP)
+}
+
+func TestSignOutAll(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	notifications := setupTestWebhook(t, cfg)
+
+	var tokenPairs []*TokenPair
+	for _, userAgent := range []string{"laptop", "phone", "tablet"} {
+		tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: userAgent})
+		assert.NoError(t, err)
+		tokenPairs = append(tokenPairs, tokenPair)
+	}
+	currentSessionID, _ := parseRefreshToken(tokenPairs[0].RefreshToken)
+	expiredSessionID, err := models.CreateSession(db, &models.Session{UserID: "user", ExpireAt: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+
+	revoked, err := SignOutAll(db, cfg, "user", currentSessionID, true, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+	assert.Equal(t, EventSessionRevoked, (<-notifications).Event)
+	assert.Equal(t, EventSessionRevoked, (<-notifications).Event)
+
+	// The expired session is removed without being reported
+	assert.Empty(t, notifications)
+	_, err = models.GetSession(db, expiredSessionID)
+	assert.Error(t, err)
+
+	_, err = ValidateToken(cfg, tokenPairs[0].AccessToken)
+	assert.NoError(t, err)
+	for _, tokenPair := range tokenPairs[1:] {
+		_, err = ValidateToken(cfg, tokenPair.AccessToken)
+		assert.EqualError(t, err, "token has been revoked")
+	}
+
+	revoked, err = SignOutAll(db, cfg, "user", currentSessionID, false, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+	_, err = ValidateToken(cfg, tokenPairs[0].AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+}
+
+func TestSignOutAllKeepsSessionsWhenDenylistFails(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	tokenPair, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+	assert.NoError(t, err)
+	sessionID, _ := parseRefreshToken(tokenPair.RefreshToken)
+
+	assert.NoError(t, db.Migrator().RenameTable("revoked_access_tokens", "revoked_access_tokens_unavailable"))
+	_, err = SignOutAll(db, cfg, "user", "", false, "127.0.0.1")
+	assert.Error(t, err)
+	assert.NoError(t, db.Migrator().RenameTable("revoked_access_tokens_unavailable", "revoked_access_tokens"))
+
+	// The session is left to be revoked again
+	_, err = models.GetSession(db, sessionID)
+	assert.NoError(t, err)
+
+	revoked, err := SignOutAll(db, cfg, "user", "", false, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+	_, err = models.GetSession(db, sessionID)
+	assert.Error(t, err)
+}
+
+func TestSignOutAllDoesNotWaitForWebhook(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	cfg.WebhookURL = server.URL
+
+	for range 3 {
+		_, err := SignIn(db, cfg, UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"})
+		assert.NoError(t, err)
+	}
+
+	start := time.Now()
+	revoked, err := SignOutAll(db, cfg, "user", "", false, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, revoked)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSignInSessionLimit(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.MaxSessionsPerUser = 2
+	cfg.SessionLimitPolicy = config.SessionLimitPolicyReject
+	notifications := setupTestWebhook(t, cfg)
+	client := UserInfo{UserID: "user", UserIP: "127.0.0.1", UserAgent: "test-agent"}
+
+	var tokenPairs []*TokenPair
+	for range 2 {
+		tokenPair, err := SignIn(db, cfg, client)
+		assert.NoError(t, err)
+		tokenPairs = append(tokenPairs, tokenPair)
+	}
+	_, err := SignIn(db, cfg, client)
+	assert.Equal(t, models.ErrSessionLimitReached, err)
+
+	// The second session was used least recently, so it is evicted
+	oldestSessionID, _ := parseRefreshToken(tokenPairs[1].RefreshToken)
+	err = db.Model(&models.Session{}).Where("session_id = ?", oldestSessionID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error
+	assert.NoError(t, err)
+
+	cfg.SessionLimitPolicy = config.SessionLimitPolicyEvict
+	_, err = SignIn(db, cfg, client)
+	assert.NoError(t, err)
+
+	notification := <-notifications
+	assert.Equal(t, EventSessionEvicted, notification.Event)
+	assert.Equal(t, oldestSessionID, notification.SessionID)
+
+	_, err = ValidateToken(cfg, tokenPairs[1].AccessToken)
+	assert.EqualError(t, err, "token has been revoked")
+	_, err = ValidateToken(cfg, tokenPairs[0].AccessToken)
+	assert.NoError(t, err)
+
+	list, err := ListSessions(db, cfg, "user", "", &SessionListRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), list.Total)
+}
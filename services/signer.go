@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"simpleAuth/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT signing method signing with the crypto.Signer of the key, so tokens can be signed
+// by keys held in an HSM or a remote signing service. Verification uses the built-in method.
+type signerMethod struct {
+	jwt.SigningMethod
+	opts crypto.SignerOpts // Hash of the signing input and padding, crypto.Hash(0) signs the input itself
+}
+
+// Returns the signing method of the algorithm.
+func signingMethodFor(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case config.AlgorithmRS512:
+		return signerMethod{jwt.SigningMethodRS512, crypto.SHA512}, nil
+	case config.AlgorithmPS256:
+		// Same salt length as rsa.SignPSS with jwt.SigningMethodPS256
+		return signerMethod{jwt.SigningMethodPS256, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}}, nil
+	case config.AlgorithmES256:
+		return signerMethod{jwt.SigningMethodES256, crypto.SHA256}, nil
+	case config.AlgorithmEdDSA:
+		return signerMethod{jwt.SigningMethodEdDSA, crypto.Hash(0)}, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+}
+
+// Signs the signing string with key, which must be a crypto.Signer.
+func (m signerMethod) Sign(signingString string, key interface{}) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key of type %T cannot sign", key)
+	}
+
+	input := []byte(signingString)
+	if hash := m.opts.HashFunc(); hash != 0 {
+		hasher := hash.New()
+		hasher.Write(input)
+		input = hasher.Sum(nil)
+	}
+
+	signature, err := signer.Sign(rand.Reader, input, m.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Alg() == config.AlgorithmES256 {
+		return ecdsaJWSSignature(signature, 32)
+	}
+	return signature, nil
+}
+
+// Converts an ASN.1 ECDSA signature to the fixed size R || S form used by JWS (RFC 7518 section 3.4).
+func ecdsaJWSSignature(signature []byte, size int) ([]byte, error) {
+	var parsed struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(signature, &parsed); err != nil || len(rest) > 0 || parsed.R.BitLen() > 8*size || parsed.S.BitLen() > 8*size {
+		return nil, fmt.Errorf("invalid ECDSA signature")
+	}
+
+	out := make([]byte, 2*size)
+	parsed.R.FillBytes(out[:size])
+	parsed.S.FillBytes(out[size:])
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"simpleAuth/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Signer hiding the key type, like keys held by an HSM or a signing service.
+type remoteSigner struct {
+	key   crypto.Signer
+	calls int
+}
+
+func (s *remoteSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *remoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.key.Sign(rand, digest, opts)
+}
+
+// Key source with a single remote signer.
+type remoteKeySource struct {
+	signer    *remoteSigner
+	algorithm string
+}
+
+func (s remoteKeySource) LoadKeys(string) ([]*config.Key, error) {
+	keyID, err := config.KeyThumbprint(s.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return []*config.Key{{ID: keyID, Algorithm: s.algorithm, PrivateKey: s.signer, PublicKey: s.signer.Public(), ActivatedAt: time.Now()}}, nil
+}
+
+func (remoteKeySource) State() string {
+	return ""
+}
+
+func TestAccessTokenSignedByRemoteSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for algorithm, privateKey := range map[string]crypto.Signer{
+		config.AlgorithmRS512: rsaKey,
+		config.AlgorithmPS256: rsaKey,
+		config.AlgorithmES256: ecKey,
+		config.AlgorithmEdDSA: edKey,
+	} {
+		signer := &remoteSigner{key: privateKey}
+		cfg := setupTestConfigWithKey(t, algorithm, privateKey)
+		cfg.Keys, err = config.LoadKeyRing(remoteKeySource{signer: signer, algorithm: algorithm}, "", algorithm, time.Hour)
+		assert.NoError(t, err)
+
+		tokenString, err := GenerateAccessToken(cfg, &CustomClaims{Subject: "user", SID: "session"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, signer.calls, algorithm)
+
+		claims, err := ValidateToken(cfg, tokenString)
+		assert.NoError(t, err, algorithm)
+		assert.Equal(t, "user", claims.Subject)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"simpleAuth/config"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Serialization of self-contained access tokens.
+// Validation of the claims is shared by all formats and done by GetTokenPayload.
+type TokenFormat interface {
+	// Signs the claims with the key.
+	Encode(key *config.Key, claims *CustomClaims) (string, error)
+	// Verifies the signature with a key of the key ring and returns the claims without validating them.
+	Decode(keys *config.KeyRing, token string) (*CustomClaims, error)
+}
+
+// Returns the format access tokens are issued in.
+func issuedTokenFormat(cfg *config.Config) TokenFormat {
+	if cfg.AccessTokenFormat == config.AccessTokenFormatPASETO {
+		return pasetoFormat{}
+	}
+	return jwtFormat{}
+}
+
+// Detects the format of the token, so tokens issued before switching formats stay valid.
+func tokenFormatOf(token string) TokenFormat {
+	if strings.HasPrefix(token, pasetoV4PublicHeader) {
+		return pasetoFormat{}
+	}
+	return jwtFormat{}
+}
+
+// Signed JWT access tokens (RFC 7519) with the key ID in the "kid" header.
+type jwtFormat struct{}
+
+func (jwtFormat) Encode(key *config.Key, claims *CustomClaims) (string, error) {
+	signingMethod, err := signingMethodFor(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.PrivateKey)
+}
+
+// The verification key is selected by the "kid" header, tokens without it are checked against the signing key.
+func (jwtFormat) Decode(keys *config.KeyRing, tokenString string) (*CustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+		key := keys.SigningKey()
+		if keyID, ok := token.Header["kid"].(string); ok {
+			var err error
+			if key, err = keys.VerificationKey(keyID); err != nil {
+				return nil, err
+			}
+		}
+
+		if !key.AcceptsAlgorithm(token.Method.Alg()) {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}